@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	c "github.com/delicb/cliware"
+)
+
+// Digest sets HTTP Digest authentication (RFC 7616) with provided username
+// and password to request. Request is sent first without authentication
+// and, when server responds with Digest challenge, it is sent again with
+// response to it. Last challenge of each host is reused for subsequent
+// requests, so they do not need additional round trip. MD5, SHA-256 and
+// their session variants are supported, as well as "auth" and "auth-int"
+// quality of protection.
+func Digest(username, password string) c.Middleware {
+	d := &digestAuth{
+		username:   username,
+		password:   password,
+		challenges: make(map[string]*digestChallenge),
+		counts:     make(map[string]*nonceCount),
+	}
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return d.do(req, next)
+		})
+	})
+}
+
+type digestAuth struct {
+	username string
+	password string
+
+	mu sync.Mutex
+	// challenges holds last challenge for each host
+	challenges map[string]*digestChallenge
+	// counts holds nonce count for each realm of each host
+	counts map[string]*nonceCount
+}
+
+// nonceCount is number of times nonce was used.
+type nonceCount struct {
+	nonce string
+	count uint32
+}
+
+// digestChallenge is parsed Digest challenge from WWW-Authenticate header.
+type digestChallenge struct {
+	host      string
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+func (d *digestAuth) do(req *http.Request, next c.Handler) (*http.Response, error) {
+	// body might have to be sent twice and for auth-int it is hashed
+	if err := bufferBody(req); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	challenge := d.challenges[req.URL.Host]
+	d.mu.Unlock()
+	if challenge != nil {
+		if err := d.authorize(req, challenge); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := next.Handle(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge = parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	challenge.host = req.URL.Host
+	d.mu.Lock()
+	d.challenges[req.URL.Host] = challenge
+	d.mu.Unlock()
+
+	retry := req.WithContext(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	if err := d.authorize(retry, challenge); err != nil {
+		return resp, nil
+	}
+	drainAndClose(resp.Body)
+	return next.Handle(retry)
+}
+
+// authorize sets Authorization header that responds to provided challenge.
+func (d *digestAuth) authorize(req *http.Request, challenge *digestChallenge) error {
+	var body []byte
+	if challenge.qop == "auth-int" && req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", d.authorization(req.Method, req.URL.RequestURI(), body, challenge, newNonce()))
+	return nil
+}
+
+// authorization returns value of Authorization header for request with
+// provided method, URI and body as response to provided challenge.
+func (d *digestAuth) authorization(method, uri string, body []byte, challenge *digestChallenge, cnonce string) string {
+	newHash := md5.New
+	algorithm := strings.ToUpper(challenge.algorithm)
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		return hashHex(newHash, []byte(s))
+	}
+
+	ha1 := h(d.username + ":" + challenge.realm + ":" + d.password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+	a2 := method + ":" + uri
+	if challenge.qop == "auth-int" {
+		a2 += ":" + hashHex(newHash, body)
+	}
+
+	params := []string{
+		fmt.Sprintf("username=%q", d.username),
+		fmt.Sprintf("realm=%q", challenge.realm),
+		fmt.Sprintf("nonce=%q", challenge.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if challenge.algorithm != "" {
+		params = append(params, "algorithm="+challenge.algorithm)
+	}
+	var response string
+	if challenge.qop == "" {
+		// RFC 2069 compatibility
+		response = h(ha1 + ":" + challenge.nonce + ":" + h(a2))
+	} else {
+		nc := fmt.Sprintf("%08x", d.nextCount(challenge))
+		response = h(strings.Join([]string{ha1, challenge.nonce, nc, cnonce, challenge.qop, h(a2)}, ":"))
+		params = append(params, "qop="+challenge.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if challenge.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", challenge.opaque))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// nextCount increases and returns nonce count for host and realm of provided
+// challenge. Count is reset when nonce changes.
+func (d *digestAuth) nextCount(challenge *digestChallenge) uint32 {
+	key := challenge.host + " " + challenge.realm
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	nc, ok := d.counts[key]
+	if !ok || nc.nonce != challenge.nonce {
+		nc = &nonceCount{nonce: challenge.nonce}
+		d.counts[key] = nc
+	}
+	nc.count++
+	return nc.count
+}
+
+func hashHex(newHash func() hash.Hash, data []byte) string {
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseDigestChallenge returns supported Digest challenge from provided
+// values of WWW-Authenticate header. If there are multiple, SHA-256 is
+// preferred over MD5. Nil is returned if there is no supported challenge.
+func parseDigestChallenge(values []string) *digestChallenge {
+	var best *digestChallenge
+	for _, ch := range parseChallenges(values) {
+		if !strings.EqualFold(ch.scheme, "Digest") {
+			continue
+		}
+		challenge := &digestChallenge{
+			realm:     ch.params["realm"],
+			nonce:     ch.params["nonce"],
+			opaque:    ch.params["opaque"],
+			algorithm: ch.params["algorithm"],
+		}
+		switch strings.ToUpper(challenge.algorithm) {
+		case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		default:
+			continue
+		}
+		if qop, ok := ch.params["qop"]; ok {
+			options := strings.Split(qop, ",")
+			for i := range options {
+				options[i] = strings.TrimSpace(options[i])
+			}
+			switch {
+			case stringInSlice("auth", options):
+				challenge.qop = "auth"
+			case stringInSlice("auth-int", options):
+				challenge.qop = "auth-int"
+			default:
+				continue
+			}
+		}
+		if challenge.nonce == "" {
+			continue
+		}
+		if best == nil || (!strings.HasPrefix(strings.ToUpper(best.algorithm), "SHA-256") &&
+			strings.HasPrefix(strings.ToUpper(challenge.algorithm), "SHA-256")) {
+			best = challenge
+		}
+	}
+	return best
+}
+
+// authChallenge is single challenge from WWW-Authenticate header.
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges parses challenges from provided values of
+// WWW-Authenticate header. Parameter names are lowercased.
+func parseChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range values {
+		s := value
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+			var token string
+			token, s = readToken(s)
+			if token == "" {
+				// invalid value, skip rest of it
+				break
+			}
+			rest := strings.TrimLeft(s, " \t")
+			if strings.HasPrefix(rest, "=") && len(challenges) > 0 {
+				// parameter of current challenge
+				var v string
+				v, s = readValue(strings.TrimLeft(rest[1:], " \t"))
+				challenges[len(challenges)-1].params[strings.ToLower(token)] = v
+				continue
+			}
+			challenges = append(challenges, authChallenge{scheme: token, params: make(map[string]string)})
+		}
+	}
+	return challenges
+}
+
+// readToken reads token from beginning of provided string and returns it
+// together with rest of string.
+func readToken(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=\"")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// readValue reads token or quoted string from beginning of provided string
+// and returns it together with rest of string.
+func readValue(s string) (string, string) {
+	if !strings.HasPrefix(s, "\"") {
+		return readToken(s)
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+func stringInSlice(s string, in []string) bool {
+	for _, ss := range in {
+		if s == ss {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// example from RFC 7616, section 3.9.1
+	d := &digestAuth{
+		username: "Mufasa",
+		password: "Circle of Life",
+		counts:   make(map[string]*nonceCount),
+	}
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	for _, data := range []struct {
+		Algorithm string
+		Response  string
+	}{
+		{Algorithm: "MD5", Response: "8ca523f5e9506fed4657c9700eebdbec"},
+		{Algorithm: "SHA-256", Response: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	} {
+		challenge := parseDigestChallenge([]string{`Digest realm="http-auth@example.org", qop="auth, auth-int", ` +
+			`algorithm=` + data.Algorithm + `, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", ` +
+			`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`})
+		// nonce count is per realm, so it is reset for each case
+		d.counts = make(map[string]*nonceCount)
+		got := d.authorization("GET", "/dir/index.html", nil, challenge, cnonce)
+		expected := `Digest username="Mufasa", realm="http-auth@example.org", ` +
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", ` +
+			`algorithm=` + data.Algorithm + `, qop=auth, nc=00000001, cnonce="` + cnonce + `", ` +
+			`response="` + data.Response + `", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+		if got != expected {
+			t.Errorf("Wrong authorization.\nGot:      %s\nexpected: %s", got, expected)
+		}
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	for _, data := range []struct {
+		Values   []string
+		Expected *digestChallenge
+	}{
+		{
+			Values: []string{`Basic realm="basic", Digest realm="r", nonce="n", algorithm=MD5, qop="auth-int"`,
+				`Digest realm="r", nonce="n2", algorithm=SHA-256, qop="auth,auth-int", opaque="o"`},
+			Expected: &digestChallenge{realm: "r", nonce: "n2", opaque: "o", algorithm: "SHA-256", qop: "auth"},
+		},
+		{
+			Values:   []string{`Digest realm="r", nonce="n", algorithm=MD5, qop="auth-int"`},
+			Expected: &digestChallenge{realm: "r", nonce: "n", algorithm: "MD5", qop: "auth-int"},
+		},
+		{
+			Values:   []string{`Digest realm="quoted \"realm\"", nonce=n`},
+			Expected: &digestChallenge{realm: `quoted "realm"`, nonce: "n"},
+		},
+		{Values: []string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`}},
+		{Values: []string{`Digest realm="r", nonce="n", qop="unknown"`}},
+		{Values: []string{`Negotiate abc==`, `Basic realm="r"`}},
+	} {
+		got := parseDigestChallenge(data.Values)
+		if !reflect.DeepEqual(got, data.Expected) {
+			t.Errorf("Wrong challenge for %v. Got: %+v, expected: %+v.", data.Values, got, data.Expected)
+		}
+	}
+}
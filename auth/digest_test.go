@@ -0,0 +1,189 @@
+package auth_test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/body"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+var digestParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+// digestServer is server that requires Digest authentication with username
+// "user" and password "pass".
+type digestServer struct {
+	algorithm string
+	qop       string
+	nonce     string
+	requests  int
+	counts    []string
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	if !s.valid(r) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", nonce=%q, algorithm=%s, qop=%q, opaque="op"`,
+			s.nonce, s.algorithm, s.qop))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+func (s *digestServer) valid(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Digest ") {
+		return false
+	}
+	params := map[string]string{}
+	for _, m := range digestParam.FindAllStringSubmatch(authorization, -1) {
+		params[m[1]] = m[2] + m[3]
+	}
+	if params["nonce"] != s.nonce || params["opaque"] != "op" || params["uri"] != r.URL.RequestURI() {
+		return false
+	}
+	s.counts = append(s.counts, params["nc"])
+
+	newHash := md5.New
+	if strings.HasPrefix(s.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(data string) string {
+		return hexHash(newHash, []byte(data))
+	}
+	ha1 := h("user:test:pass")
+	if strings.HasSuffix(s.algorithm, "-sess") {
+		ha1 = h(ha1 + ":" + s.nonce + ":" + params["cnonce"])
+	}
+	a2 := r.Method + ":" + params["uri"]
+	if params["qop"] == "auth-int" {
+		data, _ := ioutil.ReadAll(r.Body)
+		a2 += ":" + hexHash(newHash, data)
+	}
+	expected := h(strings.Join([]string{ha1, s.nonce, params["nc"], params["cnonce"], params["qop"], h(a2)}, ":"))
+	return params["response"] == expected
+}
+
+func hexHash(newHash func() hash.Hash, data []byte) string {
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestDigest(t *testing.T) {
+	for _, data := range []struct {
+		Algorithm string
+		Qop       string
+	}{
+		{Algorithm: "MD5", Qop: "auth"},
+		{Algorithm: "MD5-sess", Qop: "auth"},
+		{Algorithm: "SHA-256", Qop: "auth,auth-int"},
+		{Algorithm: "SHA-256-sess", Qop: "auth-int"},
+	} {
+		s := &digestServer{algorithm: data.Algorithm, qop: data.Qop, nonce: "nonce-1"}
+		server := httptest.NewServer(s)
+		client := &http.Client{}
+		m := auth.Digest("user", "pass")
+
+		for i := 0; i < 3; i++ {
+			chain := cliware.NewChain(url.URL(server.URL+"/path?q=1"), body.String("data"), m)
+			resp, err := chain.Exec(cliware.HandlerFunc(client.Do)).Handle(cliware.EmptyRequest())
+			if err != nil {
+				t.Fatal("Got error sending request: ", err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s %s: wrong status. Got: %d, expected: 200.", data.Algorithm, data.Qop, resp.StatusCode)
+			}
+			resp.Body.Close()
+		}
+		// only first request needs additional round trip
+		if s.requests != 4 {
+			t.Errorf("%s %s: wrong number of requests. Got: %d, expected: 4.", data.Algorithm, data.Qop, s.requests)
+		}
+		expectedCounts := "00000001 00000002 00000003"
+		if got := strings.Join(s.counts, " "); got != expectedCounts {
+			t.Errorf("%s %s: wrong nonce counts. Got: %s, expected: %s.", data.Algorithm, data.Qop, got, expectedCounts)
+		}
+		server.Close()
+	}
+}
+
+func TestDigestNewNonce(t *testing.T) {
+	s := &digestServer{algorithm: "MD5", qop: "auth", nonce: "nonce-1"}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := &http.Client{}
+	m := auth.Digest("user", "pass")
+	send := func() int {
+		resp, err := cliware.NewChain(url.URL(server.URL), m).Exec(cliware.HandlerFunc(client.Do)).Handle(cliware.EmptyRequest())
+		if err != nil {
+			t.Fatal("Got error sending request: ", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	send()
+	// server changes nonce, so cached challenge is rejected and new one used
+	s.nonce = "nonce-2"
+	if status := send(); status != http.StatusOK {
+		t.Errorf("Wrong status. Got: %d, expected: 200.", status)
+	}
+	if got := strings.Join(s.counts, " "); got != "00000001 00000001" {
+		t.Errorf("Nonce count not reset for new nonce: %s.", got)
+	}
+}
+
+func TestDigestHostsSharingRealm(t *testing.T) {
+	s1 := &digestServer{algorithm: "MD5", qop: "auth", nonce: "nonce-1"}
+	s2 := &digestServer{algorithm: "MD5", qop: "auth", nonce: "nonce-2"}
+	server1 := httptest.NewServer(s1)
+	defer server1.Close()
+	server2 := httptest.NewServer(s2)
+	defer server2.Close()
+	client := &http.Client{}
+	m := auth.Digest("user", "pass")
+
+	for i := 0; i < 3; i++ {
+		for _, serverURL := range []string{server1.URL, server2.URL} {
+			resp, err := cliware.NewChain(url.URL(serverURL), m).Exec(cliware.HandlerFunc(client.Do)).Handle(cliware.EmptyRequest())
+			if err != nil {
+				t.Fatal("Got error sending request: ", err)
+			}
+			resp.Body.Close()
+		}
+	}
+	// nonce count of one host must not be reset by requests to other host
+	for _, s := range []*digestServer{s1, s2} {
+		if got := strings.Join(s.counts, " "); got != "00000001 00000002 00000003" || s.requests != 4 {
+			t.Errorf("Wrong nonce counts for %s. Got: %s after %d requests, expected: 00000001 00000002 00000003 after 4 requests.", s.nonce, got, s.requests)
+		}
+	}
+}
+
+func TestDigestWrongPassword(t *testing.T) {
+	s := &digestServer{algorithm: "MD5", qop: "auth", nonce: "nonce-1"}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := &http.Client{}
+	chain := cliware.NewChain(url.URL(server.URL), auth.Digest("user", "wrong"))
+	resp, err := chain.Exec(cliware.HandlerFunc(client.Do)).Handle(cliware.EmptyRequest())
+	if err != nil {
+		t.Fatal("Got error sending request: ", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || s.requests != 2 {
+		t.Errorf("Wrong result. Got: status %d after %d requests, expected: status 401 after 2 requests.", resp.StatusCode, s.requests)
+	}
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// Signer signs requests, usually by setting headers with signature.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is function that implements Signer interface.
+type SignerFunc func(req *http.Request) error
+
+// Sign calls f(req).
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// HMAC signs request with provided signer. Signature usually covers final
+// URL, headers and body, so this middleware has to be executed after url,
+// query, headers and body middlewares. Signers for custom HMAC schemes can
+// be built with NewHMACSigner and HTTP Message Signatures are implemented
+// by MessageSigner.
+func HMAC(signer Signer) c.Middleware {
+	return c.RequestProcessor(signer.Sign)
+}
+
+// Component is part of request that is signed by HMACSigner.
+type Component string
+
+// Components of request supported by HMACSigner. Use HeaderComponent for
+// header values.
+const (
+	// ComponentMethod is request method.
+	ComponentMethod Component = "method"
+	// ComponentPath is escaped path of request URL.
+	ComponentPath Component = "path"
+	// ComponentQuery is query of request URL with parameters sorted.
+	ComponentQuery Component = "query"
+	// ComponentHost is host of request.
+	ComponentHost Component = "host"
+	// ComponentTimestamp is timestamp of signing.
+	ComponentTimestamp Component = "timestamp"
+	// ComponentNonce is random nonce generated for each request.
+	ComponentNonce Component = "nonce"
+	// ComponentBodyHash is hash of request body, encoded same as signature.
+	ComponentBodyHash Component = "body-hash"
+)
+
+// HeaderComponent returns component that is value of provided header.
+// Multiple values are joined with comma.
+func HeaderComponent(header string) Component {
+	return Component("header:" + http.CanonicalHeaderKey(header))
+}
+
+// Encoding is encoding of signature and body hash.
+type Encoding int
+
+// Supported encodings.
+const (
+	Hex Encoding = iota
+	Base64
+)
+
+// HMACSigner is Signer for custom HMAC schemes. Selected components of
+// request are joined with separator and signed with HMAC. Signature is set
+// to header in configured format. HMACSigner is configured using builder
+// methods, which all return the same signer, so calls can be chained:
+//
+//	signer := auth.NewHMACSigner("key-id", secret).
+//		Components(auth.ComponentMethod, auth.ComponentPath, auth.ComponentTimestamp).
+//		Hash(sha512.New).
+//		Encoding(auth.Base64).
+//		SignatureHeader("X-Signature", "{signature}")
+//
+// By default method, path, query, timestamp and body hash are signed with
+// HMAC-SHA256, separated by new line. Timestamp is Unix time in seconds set
+// to X-Timestamp header and signature is hex encoded in Authorization
+// header with format "HMAC {keyId}:{signature}".
+type HMACSigner struct {
+	keyID      string
+	key        []byte
+	components []Component
+	newHash    func() hash.Hash
+	encoding   Encoding
+	separator  string
+
+	timestampHeader string
+	timestampFormat string
+	nonceHeader     string
+	signatureHeader string
+	format          string
+
+	now      func() time.Time
+	newNonce func() string
+}
+
+// NewHMACSigner creates HMACSigner with provided key ID and secret key and
+// default configuration.
+func NewHMACSigner(keyID string, key []byte) *HMACSigner {
+	return &HMACSigner{
+		keyID:           keyID,
+		key:             key,
+		components:      []Component{ComponentMethod, ComponentPath, ComponentQuery, ComponentTimestamp, ComponentBodyHash},
+		newHash:         sha256.New,
+		encoding:        Hex,
+		separator:       "\n",
+		timestampHeader: "X-Timestamp",
+		signatureHeader: "Authorization",
+		format:          "HMAC {keyId}:{signature}",
+		now:             time.Now,
+		newNonce:        newNonce,
+	}
+}
+
+// Components sets components of request that are signed, in provided order.
+func (s *HMACSigner) Components(components ...Component) *HMACSigner {
+	s.components = components
+	return s
+}
+
+// Hash sets hash function used for HMAC and body hash, e.g. sha256.New or
+// sha512.New.
+func (s *HMACSigner) Hash(newHash func() hash.Hash) *HMACSigner {
+	s.newHash = newHash
+	return s
+}
+
+// Encoding sets encoding of signature and body hash.
+func (s *HMACSigner) Encoding(encoding Encoding) *HMACSigner {
+	s.encoding = encoding
+	return s
+}
+
+// Separator sets string that separates signed components.
+func (s *HMACSigner) Separator(separator string) *HMACSigner {
+	s.separator = separator
+	return s
+}
+
+// Timestamp sets header that timestamp is sent in and its format. Format is
+// time layout or empty for Unix time in seconds. If header is empty,
+// timestamp is not sent in separate header, but it can still be included
+// in signature header format.
+func (s *HMACSigner) Timestamp(header, format string) *HMACSigner {
+	s.timestampHeader = header
+	s.timestampFormat = format
+	return s
+}
+
+// Nonce sets header that nonce is sent in. If header is empty, nonce is not
+// sent in separate header, but it can still be included in signature
+// header format.
+func (s *HMACSigner) Nonce(header string) *HMACSigner {
+	s.nonceHeader = header
+	return s
+}
+
+// SignatureHeader sets header that signature is sent in and format of its
+// value. Format can contain placeholders {keyId}, {signature},
+// {timestamp}, {nonce} and {algorithm} (e.g. "hmac-sha256").
+func (s *HMACSigner) SignatureHeader(header, format string) *HMACSigner {
+	s.signatureHeader = header
+	s.format = format
+	return s
+}
+
+// Sign is implementation of Signer interface.
+func (s *HMACSigner) Sign(req *http.Request) error {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	if s.timestampFormat != "" {
+		timestamp = s.now().UTC().Format(s.timestampFormat)
+	}
+	nonce := s.newNonce()
+	if s.timestampHeader != "" {
+		req.Header.Set(s.timestampHeader, timestamp)
+	}
+	if s.nonceHeader != "" {
+		req.Header.Set(s.nonceHeader, nonce)
+	}
+
+	values := make([]string, len(s.components))
+	for i, component := range s.components {
+		switch component {
+		case ComponentMethod:
+			values[i] = req.Method
+		case ComponentPath:
+			values[i] = req.URL.EscapedPath()
+		case ComponentQuery:
+			values[i] = req.URL.Query().Encode()
+		case ComponentHost:
+			values[i] = requestHost(req)
+		case ComponentTimestamp:
+			values[i] = timestamp
+		case ComponentNonce:
+			values[i] = nonce
+		case ComponentBodyHash:
+			body, err := readBody(req)
+			if err != nil {
+				return err
+			}
+			h := s.newHash()
+			h.Write(body)
+			values[i] = s.encode(h.Sum(nil))
+		default:
+			name := strings.TrimPrefix(string(component), "header:")
+			values[i] = strings.Join(req.Header.Values(name), ",")
+		}
+	}
+
+	mac := hmac.New(s.newHash, s.key)
+	mac.Write([]byte(strings.Join(values, s.separator)))
+	signature := s.encode(mac.Sum(nil))
+	req.Header.Set(s.signatureHeader, strings.NewReplacer(
+		"{keyId}", s.keyID,
+		"{signature}", signature,
+		"{timestamp}", timestamp,
+		"{nonce}", nonce,
+		"{algorithm}", "hmac-sha"+strconv.Itoa(s.newHash().Size()*8),
+	).Replace(s.format))
+	return nil
+}
+
+func (s *HMACSigner) encode(data []byte) string {
+	if s.encoding == Base64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// readBody returns body of request. Body is buffered first if it can not be
+// read twice (see bufferBody).
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if err := bufferBody(req); err != nil {
+		return nil, err
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// bufferBody reads body of request to memory and sets GetBody, if it is not
+// already set, so that body can be read multiple times.
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// requestHost returns host of request.
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// newNonce returns random nonce.
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
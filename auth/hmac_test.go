@@ -0,0 +1,185 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/body"
+	"github.com/delicb/cliware-middlewares/headers"
+	"github.com/delicb/cliware-middlewares/query"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+func hmacHex(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACDefault(t *testing.T) {
+	key := []byte("secret")
+	chain := cliware.NewChain(
+		url.URL("https://example.com/items"),
+		query.Set("b", "2"),
+		query.Add("a", "1"),
+		body.Reader(strings.NewReader("data")),
+		auth.HMAC(auth.NewHMACSigner("key-id", key)),
+	)
+	req := cliware.EmptyRequest()
+	if _, err := chain.Exec(createHandler()).Handle(req); err != nil {
+		t.Fatal("Got error processing request: ", err)
+	}
+	timestamp := req.Header.Get("X-Timestamp")
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(seconds, 0)) > time.Minute {
+		t.Errorf("Wrong timestamp: %s.", timestamp)
+	}
+	bodyHash := sha256.Sum256([]byte("data"))
+	canonical := strings.Join([]string{"POST", "/items", "a=1&b=2", timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+	expected := "HMAC key-id:" + hmacHex(key, canonical)
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("Wrong signature. Got: %s, expected: %s.", got, expected)
+	}
+}
+
+func TestHMACCustom(t *testing.T) {
+	key := []byte("secret")
+	signer := auth.NewHMACSigner("key-id", key).
+		Components(auth.ComponentHost, auth.ComponentNonce, auth.ComponentTimestamp, auth.HeaderComponent("x-client")).
+		Hash(sha512.New).
+		Encoding(auth.Base64).
+		Separator("|").
+		Timestamp("", time.RFC3339).
+		Nonce("X-Nonce").
+		SignatureHeader("X-Signature", "{algorithm} id={keyId} ts={timestamp} sig={signature}")
+	chain := cliware.NewChain(
+		url.URL("https://example.com/"),
+		headers.Set("X-Client", "test"),
+		auth.HMAC(signer),
+	)
+	req := cliware.EmptyRequest()
+	if _, err := chain.Exec(createHandler()).Handle(req); err != nil {
+		t.Fatal("Got error processing request: ", err)
+	}
+	if req.Header.Get("X-Timestamp") != "" {
+		t.Error("Timestamp header set when not configured.")
+	}
+	nonce := req.Header.Get("X-Nonce")
+	m := regexp.MustCompile(`^hmac-sha512 id=key-id ts=(\S+) sig=(\S+)$`).FindStringSubmatch(req.Header.Get("X-Signature"))
+	if m == nil {
+		t.Fatalf("Wrong signature header format: %s.", req.Header.Get("X-Signature"))
+	}
+	if _, err := time.Parse(time.RFC3339, m[1]); err != nil {
+		t.Errorf("Wrong timestamp format: %s.", m[1])
+	}
+	mac := hmac.New(sha512.New, key)
+	mac.Write([]byte(strings.Join([]string{"example.com", nonce, m[1], "test"}, "|")))
+	if expected := base64.StdEncoding.EncodeToString(mac.Sum(nil)); m[2] != expected {
+		t.Errorf("Wrong signature. Got: %s, expected: %s.", m[2], expected)
+	}
+}
+
+func TestHMACSignerFunc(t *testing.T) {
+	myErr := errors.New("my error")
+	m := auth.HMAC(auth.SignerFunc(func(req *http.Request) error { return myErr }))
+	if _, err := m.Exec(createHandler()).Handle(cliware.EmptyRequest()); err != myErr {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, myErr)
+	}
+}
+
+var signatureParams = regexp.MustCompile(`^sig1=\(("[^)]*")\);created=(\d+);expires=(\d+);nonce="([0-9a-f]+)";keyid="key"$`)
+
+func TestMessageSigner(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	for _, key := range []interface{}{[]byte("secret"), rsaKey, ecKey, edKey} {
+		signer, err := auth.NewMessageSigner("key", key)
+		if err != nil {
+			t.Fatal("Failed to create signer: ", err)
+		}
+		signer.Expires(time.Minute).WithNonce()
+		chain := cliware.NewChain(
+			url.URL("https://example.com:443/path?q=1"),
+			body.String("data"),
+			auth.HMAC(signer),
+		)
+		req := cliware.EmptyRequest()
+		if _, err := chain.Exec(createHandler()).Handle(req); err != nil {
+			t.Fatal("Got error processing request: ", err)
+		}
+		m := signatureParams.FindStringSubmatch(req.Header.Get("Signature-Input"))
+		if m == nil {
+			t.Fatalf("Wrong Signature-Input: %s.", req.Header.Get("Signature-Input"))
+		}
+		if m[1] != `"@method" "@authority" "@path" "@query" "content-digest"` {
+			t.Errorf("Wrong default components: %s.", m[1])
+		}
+		if req.Header.Get("Content-Digest") != "sha-256=:Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=:" {
+			t.Errorf("Wrong Content-Digest: %s.", req.Header.Get("Content-Digest"))
+		}
+
+		base := `"@method": POST` + "\n" +
+			`"@authority": example.com` + "\n" +
+			`"@path": /path` + "\n" +
+			`"@query": ?q=1` + "\n" +
+			`"content-digest": ` + req.Header.Get("Content-Digest") + "\n" +
+			`"@signature-params": ` + strings.TrimPrefix(req.Header.Get("Signature-Input"), "sig1=")
+		signature, _ := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimPrefix(req.Header.Get("Signature"), "sig1="), ":"))
+		if !verify(key, []byte(base), signature) {
+			t.Errorf("Invalid signature for key %T.", key)
+		}
+	}
+}
+
+// verify verifies signature created by MessageSigner.
+func verify(key interface{}, base, signature []byte) bool {
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PrivateKey:
+		digest := sha512.Sum512(base)
+		return rsa.VerifyPSS(&k.PublicKey, crypto.SHA512, digest[:], signature, &rsa.PSSOptions{SaltLength: sha512.Size}) == nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(base)
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return len(signature) == 64 && ecdsa.Verify(&k.PublicKey, digest[:], r, s)
+	case ed25519.PrivateKey:
+		return ed25519.Verify(k.Public().(ed25519.PublicKey), base, signature)
+	}
+	return false
+}
+
+func TestMessageSignerErrors(t *testing.T) {
+	if _, err := auth.NewMessageSigner("key", "string key"); err != auth.ErrUnsupportedKey {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, auth.ErrUnsupportedKey)
+	}
+	p224Key, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if _, err := auth.NewMessageSigner("key", p224Key); err != auth.ErrUnsupportedKey {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, auth.ErrUnsupportedKey)
+	}
+	signer, _ := auth.NewMessageSigner("key", []byte("secret"), "@method", "x-missing")
+	if _, err := auth.HMAC(signer).Exec(createHandler()).Handle(cliware.EmptyRequest()); err == nil {
+		t.Error("Expected error for missing header component.")
+	}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedKey is returned when key of unsupported type is used for
+// signing.
+var ErrUnsupportedKey = errors.New("auth: unsupported key type")
+
+// MessageSigner is Signer that implements HTTP Message Signatures (RFC
+// 9421). It sets Signature and Signature-Input headers and, if it is signed,
+// Content-Digest header with SHA-256 digest of body. Supported keys and
+// algorithms are:
+//
+//	[]byte             hmac-sha256
+//	ed25519.PrivateKey ed25519
+//	*rsa.PrivateKey    rsa-pss-sha512
+//	*ecdsa.PrivateKey  ecdsa-p256-sha256 or ecdsa-p384-sha384
+type MessageSigner struct {
+	keyID      string
+	key        interface{}
+	label      string
+	components []string
+	expires    time.Duration
+	nonce      bool
+
+	now func() time.Time
+}
+
+// NewMessageSigner creates MessageSigner with provided key ID and key that
+// signs provided components. Components are derived component names (e.g.
+// "@method", "@target-uri", "@authority", "@path", "@query") or lowercase
+// header names. If no components are provided, "@method", "@authority",
+// "@path" and "@query" are signed, together with "content-digest" for
+// requests with body.
+func NewMessageSigner(keyID string, key interface{}, components ...string) (*MessageSigner, error) {
+	switch k := key.(type) {
+	case []byte, ed25519.PrivateKey, *rsa.PrivateKey:
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return nil, ErrUnsupportedKey
+		}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return &MessageSigner{
+		keyID:      keyID,
+		key:        key,
+		label:      "sig1",
+		components: components,
+		now:        time.Now,
+	}, nil
+}
+
+// Label sets label of signature in Signature and Signature-Input headers.
+// Default is "sig1".
+func (s *MessageSigner) Label(label string) *MessageSigner {
+	s.label = label
+	return s
+}
+
+// Expires sets duration after which signature expires. By default
+// signatures do not expire.
+func (s *MessageSigner) Expires(d time.Duration) *MessageSigner {
+	s.expires = d
+	return s
+}
+
+// WithNonce makes signer include random nonce in signature parameters.
+func (s *MessageSigner) WithNonce() *MessageSigner {
+	s.nonce = true
+	return s
+}
+
+// Sign is implementation of Signer interface.
+func (s *MessageSigner) Sign(req *http.Request) error {
+	components := s.components
+	if len(components) == 0 {
+		components = []string{"@method", "@authority", "@path", "@query"}
+		if req.Body != nil && req.Body != http.NoBody {
+			components = append(components, "content-digest")
+		}
+	}
+
+	var base strings.Builder
+	quoted := make([]string, len(components))
+	for i, component := range components {
+		value, err := componentValue(req, component)
+		if err != nil {
+			return err
+		}
+		quoted[i] = strconv.Quote(component)
+		base.WriteString(quoted[i] + ": " + value + "\n")
+	}
+
+	created := s.now()
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10)
+	if s.expires > 0 {
+		params += ";expires=" + strconv.FormatInt(created.Add(s.expires).Unix(), 10)
+	}
+	if s.nonce {
+		params += ";nonce=" + strconv.Quote(newNonce())
+	}
+	params += ";keyid=" + strconv.Quote(s.keyID)
+	base.WriteString(`"@signature-params": ` + params)
+
+	signature, err := s.sign([]byte(base.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature-Input", s.label+"="+params)
+	req.Header.Set("Signature", s.label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// sign signs provided signature base with key of signer.
+func (s *MessageSigner) sign(base []byte) ([]byte, error) {
+	switch key := s.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, base), nil
+	case *rsa.PrivateKey:
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: sha512.Size})
+	case *ecdsa.PrivateKey:
+		return signECDSA(key, base)
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// signECDSA returns ECDSA signature of provided data as concatenated r and
+// s values, hashed with SHA-256 for P-256 curve and SHA-384 for P-384 curve.
+func signECDSA(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	var digest []byte
+	if key.Curve == elliptic.P384() {
+		d := sha512.Sum384(data)
+		digest = d[:]
+	} else {
+		d := sha256.Sum256(data)
+		digest = d[:]
+	}
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	sig.FillBytes(signature[size:])
+	return signature, nil
+}
+
+// componentValue returns value of provided component of request. If
+// content-digest is requested and request does not have Content-Digest
+// header, it is set first.
+func componentValue(req *http.Request, component string) (string, error) {
+	switch component {
+	case "@method":
+		if req.Method == "" {
+			return "GET", nil
+		}
+		return strings.ToUpper(req.Method), nil
+	case "@target-uri":
+		return strings.ToLower(req.URL.Scheme) + "://" + authority(req) + req.URL.RequestURI(), nil
+	case "@authority":
+		return authority(req), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if path := req.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "content-digest":
+		if req.Header.Get("Content-Digest") == "" {
+			body, err := readBody(req)
+			if err != nil {
+				return "", err
+			}
+			digest := sha256.Sum256(body)
+			req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+		}
+	case "content-length":
+		if req.Header.Get("Content-Length") == "" && req.ContentLength > 0 {
+			return strconv.FormatInt(req.ContentLength, 10), nil
+		}
+	}
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("auth: unsupported component %s", component)
+	}
+	values := req.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("auth: component %s not present in request", component)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// authority returns lowercase host of request without default port.
+func authority(req *http.Request) string {
+	return strings.ToLower(canonicalHost(req))
+}
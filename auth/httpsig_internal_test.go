@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRFC9421Request returns example request from RFC 9421, section B.2.
+func newRFC9421Request() *http.Request {
+	req, _ := http.NewRequest("POST", "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	return req
+}
+
+func TestMessageSignerVectors(t *testing.T) {
+	hmacKey, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	der, _ := base64.StdEncoding.DecodeString("MC4CAQAwBQYDK2VwBCIEIJ+DYvh6SEqVTm50DFtMDoQikTmiCqirVv9mWG9qfSnF")
+	edKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal("Failed to parse key: ", err)
+	}
+
+	for _, data := range []struct {
+		KeyID      string
+		Key        interface{}
+		Label      string
+		Components []string
+		Signature  string
+	}{
+		{
+			KeyID:      "test-shared-secret",
+			Key:        hmacKey,
+			Label:      "sig-b25",
+			Components: []string{"date", "@authority", "content-type"},
+			Signature:  "pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=",
+		},
+		{
+			KeyID:      "test-key-ed25519",
+			Key:        edKey.(ed25519.PrivateKey),
+			Label:      "sig-b26",
+			Components: []string{"date", "@method", "@path", "@authority", "content-type", "content-length"},
+			Signature:  "wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==",
+		},
+	} {
+		signer, err := NewMessageSigner(data.KeyID, data.Key, data.Components...)
+		if err != nil {
+			t.Fatal("Failed to create signer: ", err)
+		}
+		signer.Label(data.Label)
+		signer.now = func() time.Time { return time.Unix(1618884473, 0) }
+		req := newRFC9421Request()
+		if err := signer.Sign(req); err != nil {
+			t.Fatal("Failed to sign request: ", err)
+		}
+		quoted := `"` + strings.Join(data.Components, `" "`) + `"`
+		expectedInput := data.Label + "=(" + quoted + `);created=1618884473;keyid="` + data.KeyID + `"`
+		if got := req.Header.Get("Signature-Input"); got != expectedInput {
+			t.Errorf("Wrong Signature-Input.\nGot:      %s\nexpected: %s", got, expectedInput)
+		}
+		expected := data.Label + "=:" + data.Signature + ":"
+		if got := req.Header.Get("Signature"); got != expected {
+			t.Errorf("Wrong Signature.\nGot:      %s\nexpected: %s", got, expected)
+		}
+	}
+}
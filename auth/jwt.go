@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// ErrInvalidPEM is returned when PEM encoded key can not be parsed.
+var ErrInvalidPEM = errors.New("auth: invalid PEM encoded key")
+
+var defaultJWTTTL = 5 * time.Minute
+
+// Claims are claims of JSON Web Token.
+type Claims map[string]interface{}
+
+// ClaimsFunc returns claims of token for provided request.
+type ClaimsFunc func(req *http.Request) (Claims, error)
+
+// JWTOptions hold options of JWT middleware.
+type JWTOptions struct {
+	// TTL is lifetime of token. Default is 5 minutes.
+	TTL time.Duration
+	// Cache indicates if tokens are reused until they are about to expire.
+	// Tokens are cached per audience and claims function is called only
+	// when new token is minted.
+	Cache bool
+	// KeyID is set as "kid" in token header, if not empty.
+	KeyID string
+}
+
+// JWT sets bearer authentication with JSON Web Token signed with provided
+// key to request. Key type determines algorithm: []byte is used for HS256,
+// *rsa.PrivateKey for RS256 and *ecdsa.PrivateKey with P-256 curve for
+// ES256. Keys can be loaded with ParsePEMKey. Claims returned by provided
+// function (which can be nil) are extended with "iat", "exp", "aud" (host
+// of request) and "jti" claims, if they are not already set.
+func JWT(claims ClaimsFunc, key interface{}, options JWTOptions) c.Middleware {
+	alg, err := jwtAlgorithm(key)
+	if err != nil {
+		return c.RequestProcessor(func(req *http.Request) error {
+			return err
+		})
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultJWTTTL
+	}
+	j := &jwtMinter{
+		claims:  claims,
+		key:     key,
+		alg:     alg,
+		options: options,
+		now:     time.Now,
+		cache:   make(map[string]*cachedJWT),
+	}
+	return c.RequestProcessor(func(req *http.Request) error {
+		token, err := j.token(req)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// jwtAlgorithm returns JWT algorithm for provided key.
+func jwtAlgorithm(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case []byte:
+		return "HS256", nil
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return "ES256", nil
+		}
+	}
+	return "", ErrUnsupportedKey
+}
+
+type jwtMinter struct {
+	claims  ClaimsFunc
+	key     interface{}
+	alg     string
+	options JWTOptions
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*cachedJWT
+}
+
+// cachedJWT is token cached for single audience.
+type cachedJWT struct {
+	token  string
+	expiry time.Time
+}
+
+// token returns token for provided request, either cached or new one.
+func (j *jwtMinter) token(req *http.Request) (string, error) {
+	audience := canonicalHost(req)
+	now := j.now()
+	if j.options.Cache {
+		j.mu.Lock()
+		cached, ok := j.cache[audience]
+		j.mu.Unlock()
+		if ok && now.Add(expiryDelta).Before(cached.expiry) {
+			return cached.token, nil
+		}
+	}
+
+	claims := Claims{}
+	if j.claims != nil {
+		custom, err := j.claims(req)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range custom {
+			claims[k] = v
+		}
+	}
+	expiry := now.Add(j.options.TTL)
+	setDefaultClaim(claims, "iat", now.Unix())
+	setDefaultClaim(claims, "exp", expiry.Unix())
+	setDefaultClaim(claims, "aud", audience)
+	setDefaultClaim(claims, "jti", newNonce())
+
+	token, err := j.sign(claims)
+	if err != nil {
+		return "", err
+	}
+	if j.options.Cache {
+		j.mu.Lock()
+		j.cache[audience] = &cachedJWT{token: token, expiry: expiry}
+		j.mu.Unlock()
+	}
+	return token, nil
+}
+
+func setDefaultClaim(claims Claims, name string, value interface{}) {
+	if _, ok := claims[name]; !ok {
+		claims[name] = value
+	}
+}
+
+// sign returns signed token with provided claims.
+func (j *jwtMinter) sign(claims Claims) (string, error) {
+	header := map[string]string{"alg": j.alg, "typ": "JWT"}
+	if j.options.KeyID != "" {
+		header["kid"] = j.options.KeyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var signature []byte
+	switch key := j.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		signature, err = signECDSA(key, []byte(signingInput))
+	}
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParsePEMKey parses PEM encoded private key. PKCS #1 and SEC 1 keys are
+// supported, as well as PKCS #8 RSA, ECDSA and Ed25519 keys. Returned key is
+// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+func ParsePEMKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+			return key, nil
+		}
+	}
+	return nil, ErrInvalidPEM
+}
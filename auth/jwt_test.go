@@ -0,0 +1,178 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+// sendJWT processes request to provided URL with provided JWT middleware and
+// returns token from Authorization header.
+func sendJWT(t *testing.T, m cliware.Middleware, rawURL string) string {
+	req := cliware.EmptyRequest()
+	if _, err := cliware.NewChain(url.URL(rawURL), m).Exec(createHandler()).Handle(req); err != nil {
+		t.Fatal("Got error processing request: ", err)
+	}
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		t.Fatalf("Wrong Authorization header: %s.", authorization)
+	}
+	return strings.TrimPrefix(authorization, "Bearer ")
+}
+
+// decodeJWT verifies token with provided key and returns its header and
+// claims.
+func decodeJWT(t *testing.T, token string, key interface{}) (map[string]interface{}, map[string]interface{}) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Invalid token: %s.", token)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256(signingInput)
+	valid := false
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signingInput)
+		valid = hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PrivateKey:
+		valid = rsa.VerifyPKCS1v15(&k.PublicKey, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PrivateKey:
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		valid = len(signature) == 64 && ecdsa.Verify(&k.PublicKey, digest[:], r, s)
+	}
+	if !valid {
+		t.Errorf("Invalid signature of token for key %T.", key)
+	}
+	var header, claims map[string]interface{}
+	data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(data, &header)
+	data, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(data, &claims)
+	return header, claims
+}
+
+func toPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal("Failed to marshal key: ", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	parsedRSA, err := auth.ParsePEMKey(toPEM(t, rsaKey))
+	if err != nil {
+		t.Fatal("Failed to parse RSA key: ", err)
+	}
+	parsedEC, err := auth.ParsePEMKey(toPEM(t, ecKey))
+	if err != nil {
+		t.Fatal("Failed to parse EC key: ", err)
+	}
+
+	for _, data := range []struct {
+		Key interface{}
+		Alg string
+	}{
+		{Key: []byte("secret"), Alg: "HS256"},
+		{Key: parsedRSA, Alg: "RS256"},
+		{Key: parsedEC, Alg: "ES256"},
+	} {
+		claimsFunc := func(req *http.Request) (auth.Claims, error) {
+			return auth.Claims{"sub": "service", "path": req.URL.Path}, nil
+		}
+		m := auth.JWT(claimsFunc, data.Key, auth.JWTOptions{TTL: time.Minute, KeyID: "key-1"})
+		token := sendJWT(t, m, "https://api.example.com:443/items")
+		header, claims := decodeJWT(t, token, data.Key)
+
+		if header["alg"] != data.Alg || header["typ"] != "JWT" || header["kid"] != "key-1" {
+			t.Errorf("Wrong header: %v.", header)
+		}
+		if claims["sub"] != "service" || claims["path"] != "/items" || claims["aud"] != "api.example.com" {
+			t.Errorf("Wrong claims: %v.", claims)
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+		if exp-iat != 60 || time.Since(time.Unix(int64(iat), 0)) > time.Minute {
+			t.Errorf("Wrong iat or exp: %v, %v.", claims["iat"], claims["exp"])
+		}
+		if jti, _ := claims["jti"].(string); len(jti) != 32 {
+			t.Errorf("Wrong jti: %v.", claims["jti"])
+		}
+	}
+}
+
+func TestJWTCache(t *testing.T) {
+	key := []byte("secret")
+	cached := auth.JWT(nil, key, auth.JWTOptions{Cache: true})
+	first := sendJWT(t, cached, "https://a.example.com/")
+	if second := sendJWT(t, cached, "https://a.example.com/other"); second != first {
+		t.Error("Cached token not reused for same audience.")
+	}
+	other := sendJWT(t, cached, "https://b.example.com/")
+	if _, claims := decodeJWT(t, other, key); other == first || claims["aud"] != "b.example.com" {
+		t.Errorf("Wrong token for other audience: %v.", claims)
+	}
+
+	// tokens that expire too soon are never reused
+	shortLived := auth.JWT(nil, key, auth.JWTOptions{Cache: true, TTL: 5 * time.Second})
+	if sendJWT(t, shortLived, "https://a.example.com/") == sendJWT(t, shortLived, "https://a.example.com/") {
+		t.Error("Token reused close to expiry.")
+	}
+	uncached := auth.JWT(nil, key, auth.JWTOptions{})
+	if sendJWT(t, uncached, "https://a.example.com/") == sendJWT(t, uncached, "https://a.example.com/") {
+		t.Error("Token reused without cache.")
+	}
+}
+
+func TestJWTClaimsOverride(t *testing.T) {
+	key := []byte("secret")
+	m := auth.JWT(func(req *http.Request) (auth.Claims, error) {
+		return auth.Claims{"aud": "custom", "exp": 1}, nil
+	}, key, auth.JWTOptions{})
+	_, claims := decodeJWT(t, sendJWT(t, m, "https://example.com/"), key)
+	if claims["aud"] != "custom" || claims["exp"] != float64(1) {
+		t.Errorf("Claims from function overridden: %v.", claims)
+	}
+}
+
+func TestJWTErrors(t *testing.T) {
+	myErr := errors.New("my error")
+	m := auth.JWT(func(req *http.Request) (auth.Claims, error) {
+		return nil, myErr
+	}, []byte("secret"), auth.JWTOptions{})
+	if _, err := m.Exec(createHandler()).Handle(cliware.EmptyRequest()); err != myErr {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, myErr)
+	}
+
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	m = auth.JWT(nil, p384Key, auth.JWTOptions{})
+	if _, err := m.Exec(createHandler()).Handle(cliware.EmptyRequest()); err != auth.ErrUnsupportedKey {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, auth.ErrUnsupportedKey)
+	}
+
+	if _, err := auth.ParsePEMKey([]byte("not a key")); err != auth.ErrInvalidPEM {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, auth.ErrInvalidPEM)
+	}
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// expiryDelta is how long before expiration token is considered expired, so
+// that it does not expire while request is in flight.
+const expiryDelta = 10 * time.Second
+
+// Token is OAuth2 access token.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is time when token expires, zero if it does not expire.
+	Expiry time.Time
+}
+
+// Valid returns true if token is set and does not expire soon.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry)
+}
+
+// authorization returns value of Authorization header for token.
+func (t *Token) authorization() string {
+	tokenType := t.TokenType
+	// token type is case insensitive, but some servers accept only "Bearer"
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource provides OAuth2 tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenError is error returned by token endpoint.
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("auth: token endpoint returned status %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("auth: token endpoint returned error %s", e.Code)
+	}
+	return fmt.Sprintf("auth: token endpoint returned error %s: %s", e.Code, e.Description)
+}
+
+// OAuth2 sets authorization with token from provided token source to
+// request. Tokens are cached until they are about to expire and single
+// token request is shared by all concurrent requests (see CacheTokens). If
+// server responds with 401 Unauthorized, token is invalidated and request
+// is sent once more with new token. Request body is buffered, so it can be
+// sent again.
+func OAuth2(source TokenSource) c.Middleware {
+	cache := CacheTokens(source).(*cachedTokenSource)
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			// body might have to be sent twice
+			if err := bufferBody(req); err != nil {
+				return nil, err
+			}
+			token, err := cache.Token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", token.authorization())
+			resp, err := next.Handle(req)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			cache.invalidate(token)
+			token, err = cache.Token(req.Context())
+			if err != nil {
+				// first response is still valid response from server
+				return resp, nil
+			}
+			retry := req.WithContext(req.Context())
+			if req.GetBody != nil {
+				if retry.Body, err = req.GetBody(); err != nil {
+					return resp, nil
+				}
+			}
+			drainAndClose(resp.Body)
+			retry.Header.Set("Authorization", token.authorization())
+			return next.Handle(retry)
+		})
+	})
+}
+
+// drainAndClose reads small body so connection can be reused and closes it.
+func drainAndClose(body io.ReadCloser) {
+	if body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(body, 4096))
+	body.Close()
+}
+
+// CacheTokens returns token source that caches token from provided source
+// until it is about to expire. While new token is being fetched, all callers
+// wait for it instead of fetching their own. If provided source already
+// caches tokens, it is returned unchanged. Token request is cancelled when
+// all callers waiting for it give up.
+func CacheTokens(source TokenSource) TokenSource {
+	if cached, ok := source.(*cachedTokenSource); ok {
+		return cached
+	}
+	return &cachedTokenSource{source: source}
+}
+
+type cachedTokenSource struct {
+	source TokenSource
+
+	mu    sync.Mutex
+	token *Token
+	fetch *tokenFetch
+}
+
+// tokenFetch is token request in progress.
+type tokenFetch struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters is number of callers waiting for token
+	waiters int
+	token   *Token
+	err     error
+}
+
+func (s *cachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	if s.token.Valid() {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	fetch := s.fetch
+	if fetch == nil {
+		// fetch is shared, so it must not be cancelled with single caller,
+		// only when all callers gave up waiting for it
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		fetch = &tokenFetch{done: make(chan struct{}), cancel: cancel}
+		s.fetch = fetch
+		go s.doFetch(fetchCtx, fetch)
+	}
+	fetch.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		fetch.waiters--
+		if fetch.waiters == 0 && s.fetch == fetch {
+			// nobody waits for abandoned fetch, so next caller starts new one
+			s.fetch = nil
+			fetch.cancel()
+		}
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *cachedTokenSource) doFetch(ctx context.Context, fetch *tokenFetch) {
+	token, err := s.source.Token(ctx)
+	s.mu.Lock()
+	fetch.token, fetch.err = token, err
+	if err == nil {
+		s.token = token
+	}
+	if s.fetch == fetch {
+		s.fetch = nil
+	}
+	s.mu.Unlock()
+	fetch.cancel()
+	close(fetch.done)
+}
+
+// invalidate removes provided token from cache, if it is still cached.
+func (s *cachedTokenSource) invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+// OAuth2Config holds configuration of OAuth2 token endpoint.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are additional parameters sent to token endpoint.
+	EndpointParams url.Values
+	// AuthInParams indicates if client credentials are sent as parameters
+	// instead of using basic authentication.
+	AuthInParams bool
+	// Client is used for sending token requests. Default is
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// ClientCredentials returns token source that obtains tokens using OAuth2
+// client credentials grant. It does not cache tokens on its own.
+func ClientCredentials(config OAuth2Config) TokenSource {
+	return tokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return config.requestToken(ctx, url.Values{"grant_type": {"client_credentials"}})
+	})
+}
+
+// RefreshToken returns token source that obtains tokens using OAuth2
+// refresh token grant with provided refresh token. If token endpoint issues
+// new refresh token, it is used for subsequent requests. It does not cache
+// access tokens on its own.
+func RefreshToken(config OAuth2Config, refreshToken string) TokenSource {
+	var mu sync.Mutex
+	return tokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		token, err := config.requestToken(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if token.RefreshToken != "" {
+			refreshToken = token.RefreshToken
+		} else {
+			token.RefreshToken = refreshToken
+		}
+		return token, nil
+	})
+}
+
+// tokenSourceFunc is function that implements TokenSource interface.
+type tokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// tokenResponse is JSON response of token endpoint.
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	RefreshToken     string      `json:"refresh_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// requestToken sends request with provided parameters to token endpoint.
+func (config OAuth2Config) requestToken(ctx context.Context, params url.Values) (*Token, error) {
+	if len(config.Scopes) > 0 {
+		params.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	for key, values := range config.EndpointParams {
+		params[key] = values
+	}
+	if config.AuthInParams {
+		params.Set("client_id", config.ClientID)
+		if config.ClientSecret != "" {
+			params.Set("client_secret", config.ClientSecret)
+		}
+	}
+	req, err := http.NewRequest("POST", config.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !config.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tr tokenResponse
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" || mediaType == "text/plain" {
+		values, _ := url.ParseQuery(string(body))
+		tr = tokenResponse{
+			AccessToken:      values.Get("access_token"),
+			TokenType:        values.Get("token_type"),
+			RefreshToken:     values.Get("refresh_token"),
+			ExpiresIn:        json.Number(values.Get("expires_in")),
+			Error:            values.Get("error"),
+			ErrorDescription: values.Get("error_description"),
+		}
+	} else if err := json.Unmarshal(body, &tr); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("auth: invalid token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" || tr.AccessToken == "" {
+		return nil, &TokenError{StatusCode: resp.StatusCode, Code: tr.Error, Description: tr.ErrorDescription}
+	}
+
+	token := &Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if seconds, err := strconv.ParseInt(string(tr.ExpiresIn), 10, 64); err == nil && seconds > 0 {
+		token.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return token, nil
+}
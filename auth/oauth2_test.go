@@ -0,0 +1,277 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/body"
+)
+
+// newTokenServer returns token server that issues tokens "token-N", where N
+// is number of token request, and counter of token requests.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// slow down, so concurrent requests overlap
+		time.Sleep(10 * time.Millisecond)
+		n := atomic.AddInt32(&count, 1)
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+			if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": "invalid_client", "error_description": "bad credentials"}`)
+				return
+			}
+			if r.PostForm.Get("scope") != "read write" {
+				t.Errorf("Wrong scope. Got: %s, expected: read write.", r.PostForm.Get("scope"))
+			}
+		case "refresh_token":
+			if r.PostForm.Get("client_id") != "client" {
+				t.Errorf("Wrong client ID. Got: %s, expected: client.", r.PostForm.Get("client_id"))
+			}
+			// refresh tokens are rotated
+			if expected := fmt.Sprintf("refresh-%d", n-1); r.PostForm.Get("refresh_token") != expected {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "invalid_grant"}`)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    expiresIn,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	}))
+	return server, &count
+}
+
+// authHandler returns handler that responds with 401 to requests without
+// one of valid authorization headers and records authorization headers and
+// bodies of all requests.
+func authHandler(valid ...string) (cliware.Handler, *[]string) {
+	var mu sync.Mutex
+	var seen []string
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorization := req.Header.Get("Authorization")
+		if req.Body != nil {
+			if data, _ := ioutil.ReadAll(req.Body); len(data) > 0 {
+				authorization += " " + string(data)
+			}
+		}
+		seen = append(seen, authorization)
+		for _, v := range valid {
+			if req.Header.Get("Authorization") == v {
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}
+		}
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}), &seen
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	server, count := newTokenServer(t, 3600)
+	defer server.Close()
+	m := auth.OAuth2(auth.ClientCredentials(auth.OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	}))
+	handler, seen := authHandler("Bearer token-1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := m.Exec(handler).Handle(cliware.EmptyRequest())
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("Request failed: %v, %v.", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if *count != 1 {
+		t.Errorf("Wrong number of token requests. Got: %d, expected: 1.", *count)
+	}
+	if len(*seen) != 10 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 10.", len(*seen))
+	}
+}
+
+func TestOAuth2Expiry(t *testing.T) {
+	// tokens that expire within few seconds are never reused
+	server, count := newTokenServer(t, 5)
+	defer server.Close()
+	m := auth.OAuth2(auth.ClientCredentials(auth.OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	}))
+	handler, seen := authHandler("Bearer token-1", "Bearer token-2")
+	for i := 0; i < 2; i++ {
+		m.Exec(handler).Handle(cliware.EmptyRequest())
+	}
+	if *count != 2 {
+		t.Errorf("Wrong number of token requests. Got: %d, expected: 2.", *count)
+	}
+	if (*seen)[1] != "Bearer token-2" {
+		t.Errorf("Expired token used: %v.", *seen)
+	}
+}
+
+func TestOAuth2RetryUnauthorized(t *testing.T) {
+	server, count := newTokenServer(t, 3600)
+	defer server.Close()
+	// first token is revoked on server
+	handler, seen := authHandler("Bearer token-2")
+	m := auth.OAuth2(auth.RefreshToken(auth.OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		AuthInParams: true,
+	}, "refresh-0"))
+	chain := cliware.NewChain(body.String("data"), m)
+
+	resp, err := chain.Exec(handler).Handle(cliware.EmptyRequest())
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Request not retried with new token: %v, %v.", resp, err)
+	}
+	expected := []string{"Bearer token-1 data", "Bearer token-2 data"}
+	if len(*seen) != 2 || (*seen)[0] != expected[0] || (*seen)[1] != expected[1] {
+		t.Errorf("Wrong requests. Got: %v, expected: %v.", *seen, expected)
+	}
+	if *count != 2 {
+		t.Errorf("Wrong number of token requests. Got: %d, expected: 2.", *count)
+	}
+
+	// request is retried only once
+	handler, seen = authHandler()
+	resp, _ = chain.Exec(handler).Handle(cliware.EmptyRequest())
+	if resp.StatusCode != http.StatusUnauthorized || len(*seen) != 2 {
+		t.Errorf("Wrong retries of unauthorized request: %v.", *seen)
+	}
+}
+
+func TestOAuth2RetryUnauthorizedWithoutBody(t *testing.T) {
+	server, count := newTokenServer(t, 3600)
+	defer server.Close()
+	handler, seen := authHandler("Bearer token-2")
+	m := auth.OAuth2(auth.ClientCredentials(auth.OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	}))
+
+	resp, err := m.Exec(handler).Handle(cliware.EmptyRequest())
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Request not retried with new token: %v, %v.", resp, err)
+	}
+	if len(*seen) != 2 || *count != 2 {
+		t.Errorf("Wrong requests. Got: %v after %d token requests, expected 2 requests after 2 token requests.", *seen, *count)
+	}
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	server, _ := newTokenServer(t, 3600)
+	defer server.Close()
+	m := auth.OAuth2(auth.ClientCredentials(auth.OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "wrong",
+	}))
+	_, err := m.Exec(createHandler()).Handle(cliware.EmptyRequest())
+	tokenErr, ok := err.(*auth.TokenError)
+	if !ok {
+		t.Fatalf("Wrong error type. Got: %T, expected: *auth.TokenError.", err)
+	}
+	if tokenErr.StatusCode != http.StatusUnauthorized || tokenErr.Code != "invalid_client" || tokenErr.Description != "bad credentials" {
+		t.Errorf("Wrong token error: %+v.", tokenErr)
+	}
+}
+
+func TestOAuth2FormResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		fmt.Fprint(w, "access_token=form-token&token_type=bearer&expires_in=3600")
+	}))
+	defer server.Close()
+	source := auth.ClientCredentials(auth.OAuth2Config{TokenURL: server.URL})
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal("Failed to get token: ", err)
+	}
+	if token.AccessToken != "form-token" || !token.Valid() {
+		t.Errorf("Wrong token: %+v.", token)
+	}
+}
+
+func TestCacheTokens(t *testing.T) {
+	cached := auth.CacheTokens(auth.ClientCredentials(auth.OAuth2Config{}))
+	if auth.CacheTokens(cached) != cached {
+		t.Error("Cached token source wrapped again.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cached.Token(ctx); err != context.Canceled {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+	}
+}
+
+func TestCacheTokensHangingServer(t *testing.T) {
+	var count int32
+	abandoned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			// first token request hangs until client gives up, body has to
+			// be read so server notices closed connection
+			ioutil.ReadAll(r.Body)
+			<-r.Context().Done()
+			close(abandoned)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+	cached := auth.CacheTokens(auth.ClientCredentials(auth.OAuth2Config{TokenURL: server.URL}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := cached.Token(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Fatal("Abandoned token request not cancelled.")
+	}
+
+	// hanging request must not block following callers
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	token, err := cached.Token(ctx)
+	if err != nil {
+		t.Fatal("Got error getting token: ", err)
+	}
+	if token.AccessToken != "token" {
+		t.Errorf("Wrong token. Got: %s, expected: token.", token.AccessToken)
+	}
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// UnsignedPayload is value of X-Amz-Content-Sha256 header used when payload
+// is not signed. For S3, SigV4 uses it for bodies that can not be read twice.
+// To skip payload signing for other requests, set header to this value
+// before SigV4 middleware is executed.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	// emptyPayloadHash is SHA-256 hash of empty payload
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// sigV4IgnoredHeaders are headers that are not signed, because they are
+// often changed by proxies.
+var sigV4IgnoredHeaders = map[string]bool{
+	"Authorization":   true,
+	"User-Agent":      true,
+	"X-Amzn-Trace-Id": true,
+	"Expect":          true,
+	"Connection":      true,
+}
+
+// Credentials are AWS credentials used for SigV4 signing.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set only for temporary credentials.
+	SessionToken string
+}
+
+// SigV4 signs request with AWS Signature Version 4 using provided
+// credentials, region and service. Signature covers final URL, query,
+// headers and payload, so this middleware has to be executed after url,
+// query, headers and body middlewares. Authorization, X-Amz-Date and
+// X-Amz-Content-Sha256 headers are set. For S3, payload of requests whose
+// body can not be read twice (GetBody is not set) is not signed, for other
+// services such bodies are buffered in memory, since they do not accept
+// unsigned payloads.
+func SigV4(credentials Credentials, region, service string) c.Middleware {
+	s := &sigV4Signer{credentials: credentials, region: region, service: service}
+	return c.RequestProcessor(func(req *http.Request) error {
+		payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			var err error
+			if payloadHash, err = hashPayload(req, service); err != nil {
+				return err
+			}
+		}
+		s.sign(req, payloadHash, time.Now())
+		return nil
+	})
+}
+
+// Presign returns URL of provided request presigned with AWS Signature
+// Version 4 using provided credentials, region and service. URL is valid
+// for provided duration. Headers set on request are signed and have to be
+// sent with presigned URL as well.
+func Presign(req *http.Request, credentials Credentials, region, service string, expires time.Duration) string {
+	s := &sigV4Signer{credentials: credentials, region: region, service: service}
+	return s.presign(req, expires, time.Now()).String()
+}
+
+// hashPayload returns hex encoded SHA-256 hash of request body or, for S3,
+// UnsignedPayload if body can not be read twice.
+func hashPayload(req *http.Request, service string) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyPayloadHash, nil
+	}
+	if req.GetBody == nil && service == "s3" {
+		return UnsignedPayload, nil
+	}
+	if err := bufferBody(req); err != nil {
+		return "", err
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type sigV4Signer struct {
+	credentials Credentials
+	region      string
+	service     string
+}
+
+// sign sets headers with signature of provided request made at provided
+// time.
+func (s *sigV4Signer) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+s.credentials.AccessKeyID+"/"+s.scope(t)+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+s.signature(canonicalRequest, t))
+}
+
+// presign returns URL of provided request with signature in query.
+func (s *sigV4Signer) presign(req *http.Request, expires time.Duration, t time.Time) *url.URL {
+	t = t.UTC()
+	u := *req.URL
+	query := u.Query()
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.credentials.AccessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if s.credentials.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+	// payload of presigned request is not known in advance
+	payloadHash := emptyPayloadHash
+	if s.service == "s3" {
+		payloadHash = UnsignedPayload
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(&u),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + s.signature(canonicalRequest, t)
+	return &u
+}
+
+// scope returns credential scope for provided time.
+func (s *sigV4Signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature returns signature of provided canonical request.
+func (s *sigV4Signer) signature(canonicalRequest string, t time.Time) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		s.scope(t),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.credentials.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalURI returns canonical path of provided URL. Path segments are
+// encoded twice for all services except S3, for which each segment of path
+// as it is sent is encoded once.
+func (s *sigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	if s.service == "s3" {
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if unescaped, err := url.PathUnescape(segment); err == nil {
+				segment = unescaped
+			}
+			segments[i] = uriEncode(segment, true)
+		}
+		return strings.Join(segments, "/")
+	}
+	return uriEncode(path, false)
+}
+
+// canonicalQuery returns canonical query string with parameters sorted by
+// name and value.
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, v := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaders returns list of signed headers and canonical headers of
+// provided request.
+func (s *sigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": canonicalHost(req)}
+	for key, values := range req.Header {
+		if sigV4IgnoredHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(key)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalHost returns host of request without default port.
+func canonicalHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if (req.URL.Scheme == "http" && strings.HasSuffix(host, ":80")) ||
+		(req.URL.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndexByte(host, ':')]
+	}
+	return host
+}
+
+// uriEncode percent-encodes all characters except unreserved ones, as
+// required by SigV4. Slash is encoded only if encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (ch == '/' && !encodeSlash) {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{ch})))
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/body"
+	"github.com/delicb/cliware-middlewares/headers"
+	"github.com/delicb/cliware-middlewares/query"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+var testCredentials = auth.Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	SessionToken:    "session",
+}
+
+func TestSigV4(t *testing.T) {
+	for _, data := range []struct {
+		Body        cliware.Middleware
+		Service     string
+		PayloadHash string
+	}{
+		{
+			Body:        body.String(""),
+			PayloadHash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			Body:        body.String("Welcome to Amazon S3."),
+			PayloadHash: "44ce7dd67c959e0d3524ffac1771dfbba87d2b6b4b4e99e42034a8b803f8b072",
+		},
+		{
+			// streamed body can not be hashed in advance
+			Body:        body.Reader(ioutil.NopCloser(strings.NewReader("stream"))),
+			PayloadHash: auth.UnsignedPayload,
+		},
+		{
+			// other services do not accept unsigned payload
+			Body:        body.Reader(ioutil.NopCloser(strings.NewReader("stream"))),
+			Service:     "execute-api",
+			PayloadHash: "dca83e717b1f64eb141057a7415a330ad1361f51703efa2e4776f40047898a04",
+		},
+		{
+			// request without body middleware
+			Body:        cliware.NewChain(),
+			Service:     "sts",
+			PayloadHash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			Body: cliware.NewChain(
+				body.String("data"),
+				headers.Set("X-Amz-Content-Sha256", auth.UnsignedPayload),
+			),
+			PayloadHash: auth.UnsignedPayload,
+		},
+	} {
+		service := data.Service
+		if service == "" {
+			service = "s3"
+		}
+		chain := cliware.NewChain(
+			url.URL("https://bucket.s3.amazonaws.com/:key"),
+			url.Param("key", "file.txt"),
+			query.Set("versionId", "1"),
+			data.Body,
+			auth.SigV4(testCredentials, "us-east-1", service),
+		)
+		req := cliware.EmptyRequest()
+		if _, err := chain.Exec(createHandler()).Handle(req); err != nil {
+			t.Fatal("Got error processing request: ", err)
+		}
+		if got := req.Header.Get("X-Amz-Content-Sha256"); got != data.PayloadHash {
+			t.Errorf("Wrong payload hash. Got: %s, expected: %s.", got, data.PayloadHash)
+		}
+		if _, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date")); err != nil {
+			t.Errorf("Invalid X-Amz-Date: %s.", req.Header.Get("X-Amz-Date"))
+		}
+		if req.Header.Get("X-Amz-Security-Token") != "session" {
+			t.Error("Session token not set.")
+		}
+		authorization := req.Header.Get("Authorization")
+		prefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/" + time.Now().UTC().Format("20060102") + "/us-east-1/" + service + "/aws4_request, " +
+			"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="
+		if !strings.HasPrefix(authorization, prefix) || len(authorization) != len(prefix)+64 {
+			t.Errorf("Wrong authorization: %s.", authorization)
+		}
+	}
+}
+
+func TestPresign(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://bucket.s3.amazonaws.com/file.txt?versionId=1", nil)
+	presigned, err := neturl.Parse(auth.Presign(req, testCredentials, "us-east-1", "s3", 15*time.Minute))
+	if err != nil {
+		t.Fatal("Invalid presigned URL: ", err)
+	}
+	q := presigned.Query()
+	for key, expected := range map[string]string{
+		"versionId":            "1",
+		"X-Amz-Algorithm":      "AWS4-HMAC-SHA256",
+		"X-Amz-Expires":        "900",
+		"X-Amz-SignedHeaders":  "host",
+		"X-Amz-Security-Token": "session",
+	} {
+		if got := q.Get(key); got != expected {
+			t.Errorf("Wrong %s. Got: %s, expected: %s.", key, got, expected)
+		}
+	}
+	if len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("Wrong signature: %s.", q.Get("X-Amz-Signature"))
+	}
+	if req.URL.RawQuery != "versionId=1" {
+		t.Error("Presign modified original request.")
+	}
+}
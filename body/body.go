@@ -22,6 +22,9 @@ func String(data string) c.Middleware {
 		req.Method = getMethod(req)
 		req.Body = ioutil.NopCloser(strings.NewReader(data))
 		req.ContentLength = int64(bytes.NewBufferString(data).Len())
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(data)), nil
+		}
 		return nil
 	})
 }
@@ -48,6 +51,7 @@ func JSON(data interface{}) c.Middleware {
 		req.Method = getMethod(req)
 		req.Body = ioutil.NopCloser(buff)
 		req.ContentLength = int64(buff.Len())
+		req.GetBody = bytesGetBody(buff.Bytes())
 		req.Header.Set("Content-Type", "application/json")
 		return nil
 	})
@@ -74,6 +78,7 @@ func XML(data interface{}) c.Middleware {
 		req.Method = getMethod(req)
 		req.Body = ioutil.NopCloser(buff)
 		req.ContentLength = int64(buff.Len())
+		req.GetBody = bytesGetBody(buff.Bytes())
 		req.Header.Set("Content-Type", "application/xml")
 		return nil
 	})
@@ -88,14 +93,26 @@ func Reader(body io.Reader) c.Middleware {
 			rc = ioutil.NopCloser(body)
 		}
 
+		req.GetBody = nil
 		if body != nil {
 			switch v := body.(type) {
 			case *bytes.Buffer:
 				req.ContentLength = int64(v.Len())
+				req.GetBody = bytesGetBody(v.Bytes())
 			case *bytes.Reader:
 				req.ContentLength = int64(v.Len())
+				snapshot := *v
+				req.GetBody = func() (io.ReadCloser, error) {
+					r := snapshot
+					return ioutil.NopCloser(&r), nil
+				}
 			case *strings.Reader:
 				req.ContentLength = int64(v.Len())
+				snapshot := *v
+				req.GetBody = func() (io.ReadCloser, error) {
+					r := snapshot
+					return ioutil.NopCloser(&r), nil
+				}
 			}
 		}
 		req.Body = rc
@@ -104,6 +121,14 @@ func Reader(body io.Reader) c.Middleware {
 	})
 }
 
+// bytesGetBody returns function suitable for http.Request.GetBody that returns
+// new reader of provided content every time it is called.
+func bytesGetBody(content []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+}
+
 func getMethod(req *http.Request) string {
 	method := req.Method
 	if method == "GET" || method == "" {
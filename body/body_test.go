@@ -203,6 +203,52 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestGetBody(t *testing.T) {
+	for _, data := range []struct {
+		Middleware cliware.Middleware
+		Expected   string
+	}{
+		{Middleware: body.String("data"), Expected: "data"},
+		{Middleware: body.JSON("{}"), Expected: "{}"},
+		{Middleware: body.XML("<a/>"), Expected: "<a/>"},
+		{Middleware: body.Reader(bytes.NewBufferString("data")), Expected: "data"},
+		{Middleware: body.Reader(bytes.NewReader([]byte("data"))), Expected: "data"},
+		{Middleware: body.Reader(strings.NewReader("data")), Expected: "data"},
+	} {
+		req := cliware.EmptyRequest()
+		_, err := data.Middleware.Exec(createHandler()).Handle(req)
+		if err != nil {
+			t.Error("Got error processing request: ", err)
+		}
+		if req.GetBody == nil {
+			t.Fatal("GetBody not set.")
+		}
+		// reading original body must not affect GetBody
+		ioutil.ReadAll(req.Body)
+		for i := 0; i < 2; i++ {
+			rc, err := req.GetBody()
+			if err != nil {
+				t.Error("GetBody returned error: ", err)
+			}
+			bodyBytes, _ := ioutil.ReadAll(rc)
+			if string(bodyBytes) != data.Expected {
+				t.Errorf("Wrong body from GetBody. Expected: %s, got: %s", data.Expected, bodyBytes)
+			}
+		}
+	}
+}
+
+func TestReaderNoGetBody(t *testing.T) {
+	req := cliware.EmptyRequest()
+	_, err := body.Reader(ioutil.NopCloser(strings.NewReader("data"))).Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Got error processing request: ", err)
+	}
+	if req.GetBody != nil {
+		t.Error("GetBody set for body that can not be replayed.")
+	}
+}
+
 func createHandler() cliware.Handler {
 	return cliware.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
 		return nil, nil
@@ -0,0 +1,238 @@
+// Package bulkhead contains middleware that limits number of concurrent
+// requests per destination, so that one slow dependency can not take over
+// all goroutines of a process.
+//
+// Requests are grouped into pools, by default one pool per host. Pool can
+// also be chosen explicitly for request using Pool middleware. When limit of
+// concurrent requests in pool is reached, requests wait in bounded queue.
+// Requests that do not fit in queue, or whose context is done while waiting,
+// are rejected with RejectedError.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	c "github.com/delicb/cliware"
+)
+
+// ErrQueueFull is reason for rejection of requests that did not fit in queue.
+var ErrQueueFull = errors.New("bulkhead: queue is full")
+
+// RejectedError is returned for requests that were not sent because of
+// bulkhead limits.
+type RejectedError struct {
+	// Pool is name of pool request belongs to.
+	Pool string
+	// Err is reason for rejection, either ErrQueueFull or context error.
+	Err error
+}
+
+// Error is implementation of error interface for RejectedError.
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("bulkhead: request rejected by pool %q: %s", e.Pool, e.Err)
+}
+
+// Unwrap returns reason for rejection.
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Config holds configuration of bulkhead.
+type Config struct {
+	// MaxConcurrent is maximal number of requests in flight per pool.
+	// Default is 10.
+	MaxConcurrent int
+	// MaxQueue is maximal number of requests waiting per pool. Zero means
+	// that requests over limit are rejected immediately.
+	MaxQueue int
+	// KeyFunc returns name of pool for request that has no pool set via
+	// Pool middleware. Default is request host.
+	KeyFunc func(*http.Request) string
+}
+
+// Stats holds current state of single pool.
+type Stats struct {
+	// InFlight is number of requests currently being sent.
+	InFlight int
+	// Queued is number of requests waiting to be sent.
+	Queued int
+	// Rejected is total number of rejected requests.
+	Rejected uint64
+}
+
+// Bulkhead limits number of concurrent requests per pool. It is safe for
+// concurrent use.
+type Bulkhead struct {
+	config Config
+
+	mu    sync.Mutex
+	pools map[string]*pool
+}
+
+// New creates new Bulkhead with provided configuration.
+func New(config Config) *Bulkhead {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 10
+	}
+	if config.MaxQueue < 0 {
+		config.MaxQueue = 0
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = hostKey
+	}
+	return &Bulkhead{
+		config: config,
+		pools:  make(map[string]*pool),
+	}
+}
+
+// hostKey is key function that returns host of request.
+func hostKey(req *http.Request) string {
+	if req.URL != nil && req.URL.Host != "" {
+		return req.URL.Host
+	}
+	return req.Host
+}
+
+// poolKey is private type to be used for storing pool name in context.
+type poolKey struct{}
+
+// Pool sets name of pool that request belongs to.
+func Pool(name string) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, poolKey{}, name)
+	})
+}
+
+// Stats returns current state of pool with provided name.
+func (b *Bulkhead) Stats(name string) Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pools[name]
+	if !ok {
+		return Stats{}
+	}
+	return Stats{InFlight: p.inFlight, Queued: len(p.waiters), Rejected: p.rejected}
+}
+
+// Middleware returns middleware that limits number of concurrent requests.
+// Request is considered to be in flight until its response body is closed or
+// read to the end, or until error is returned if there is no response.
+func (b *Bulkhead) Middleware() c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			name, ok := req.Context().Value(poolKey{}).(string)
+			if !ok {
+				name = b.config.KeyFunc(req)
+			}
+			if err := b.acquire(req.Context(), name); err != nil {
+				return nil, err
+			}
+			var once sync.Once
+			release := func() {
+				once.Do(func() { b.release(name) })
+			}
+			resp, err := next.Handle(req)
+			if resp == nil || resp.Body == nil {
+				release()
+				return resp, err
+			}
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			return resp, err
+		})
+	})
+}
+
+// acquire takes slot in pool with provided name, waiting in queue if needed.
+func (b *Bulkhead) acquire(ctx context.Context, name string) error {
+	b.mu.Lock()
+	p, ok := b.pools[name]
+	if !ok {
+		p = &pool{}
+		b.pools[name] = p
+	}
+	if p.inFlight < b.config.MaxConcurrent {
+		p.inFlight++
+		b.mu.Unlock()
+		return nil
+	}
+	if len(p.waiters) >= b.config.MaxQueue {
+		p.rejected++
+		b.mu.Unlock()
+		return &RejectedError{Pool: name, Err: ErrQueueFull}
+	}
+	ready := make(chan struct{})
+	p.waiters = append(p.waiters, ready)
+	b.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, w := range p.waiters {
+		if w == ready {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.rejected++
+			return &RejectedError{Pool: name, Err: ctx.Err()}
+		}
+	}
+	// slot was handed over at the same time context got done, pass it on
+	b.releaseLocked(p)
+	p.rejected++
+	return &RejectedError{Pool: name, Err: ctx.Err()}
+}
+
+// release frees slot in pool with provided name.
+func (b *Bulkhead) release(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releaseLocked(b.pools[name])
+}
+
+// releaseLocked hands slot over to first waiting request or frees it if there
+// are no waiting requests. Caller has to hold lock.
+func (b *Bulkhead) releaseLocked(p *pool) {
+	if len(p.waiters) > 0 {
+		close(p.waiters[0])
+		p.waiters = p.waiters[1:]
+		return
+	}
+	p.inFlight--
+}
+
+// pool holds state of single pool.
+type pool struct {
+	inFlight int
+	waiters  []chan struct{}
+	rejected uint64
+}
+
+// releaseBody is response body that releases slot once it is closed or read
+// to the end.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,116 @@
+package bulkhead_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/bulkhead"
+)
+
+// blockingHandler returns handler that blocks until release channel is
+// closed and signals every started request on started channel.
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	})
+}
+
+func newRequest(host string) *http.Request {
+	req := cliware.EmptyRequest()
+	req.URL.Host = host
+	return req
+}
+
+func waitFor(t *testing.T, b *bulkhead.Bulkhead, pool string, expected bulkhead.Stats) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := b.Stats(pool)
+		if got == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wrong stats. Got: %+v, expected: %+v.", got, expected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	b := bulkhead.New(bulkhead.Config{MaxConcurrent: 1, MaxQueue: 1})
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	handler := b.Middleware().Exec(blockingHandler(started, release))
+
+	responses := make(chan *http.Response, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, _ := handler.Handle(newRequest("example.com"))
+			responses <- resp
+		}()
+	}
+	waitFor(t, b, "example.com", bulkhead.Stats{InFlight: 1, Queued: 1})
+
+	// third request does not fit in queue
+	_, err := handler.Handle(newRequest("example.com"))
+	rejected, ok := err.(*bulkhead.RejectedError)
+	if !ok || rejected.Err != bulkhead.ErrQueueFull {
+		t.Errorf("Wrong error. Got: %v, expected queue full rejection.", err)
+	}
+	waitFor(t, b, "example.com", bulkhead.Stats{InFlight: 1, Queued: 1, Rejected: 1})
+
+	// other pools are not affected
+	go handler.Handle(newRequest("example.org"))
+	waitFor(t, b, "example.org", bulkhead.Stats{InFlight: 1})
+
+	// closing body of response releases slot for queued request
+	close(release)
+	resp := <-responses
+	waitFor(t, b, "example.com", bulkhead.Stats{InFlight: 1, Queued: 1, Rejected: 1})
+	resp.Body.Close()
+	resp = <-responses
+	ioutil.ReadAll(resp.Body)
+	waitFor(t, b, "example.com", bulkhead.Stats{InFlight: 0, Queued: 0, Rejected: 1})
+}
+
+func TestBulkheadContext(t *testing.T) {
+	b := bulkhead.New(bulkhead.Config{MaxConcurrent: 1, MaxQueue: 5})
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	defer close(release)
+	handler := bulkhead.Pool("shared").Exec(b.Middleware().Exec(blockingHandler(started, release)))
+
+	go handler.Handle(newRequest("example.com"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := handler.Handle(newRequest("example.org").WithContext(ctx))
+	rejected, ok := err.(*bulkhead.RejectedError)
+	if !ok || rejected.Err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected deadline rejection.", err)
+	}
+	if rejected != nil && rejected.Pool != "shared" {
+		t.Errorf("Wrong pool. Got: %s, expected: shared.", rejected.Pool)
+	}
+	waitFor(t, b, "shared", bulkhead.Stats{InFlight: 1, Queued: 0, Rejected: 1})
+}
+
+func TestBulkheadError(t *testing.T) {
+	b := bulkhead.New(bulkhead.Config{MaxConcurrent: 1})
+	handler := b.Middleware().Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, context.Canceled
+	}))
+	for i := 0; i < 3; i++ {
+		if _, err := handler.Handle(newRequest("example.com")); err != context.Canceled {
+			t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+		}
+	}
+	waitFor(t, b, "example.com", bulkhead.Stats{})
+}
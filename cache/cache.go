@@ -0,0 +1,420 @@
+// Package cache contains RoundTripper that caches responses according to HTTP
+// caching rules (RFC 7234) and middlewares that control it per request.
+//
+// Cache behaves as private cache. Responses to GET requests are stored if
+// they have explicit freshness (Cache-Control max-age or Expires header) or
+// validators (ETag or Last-Modified header) and are not marked as no-store.
+// Fresh responses are served directly from cache, stale ones are revalidated
+// with conditional requests. Vary header is respected and successful unsafe
+// requests (POST, PUT, DELETE, ...) invalidate cached response for their URL.
+// Responses served from cache have X-From-Cache header set.
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// XFromCache is header that is set on responses served from cache.
+const XFromCache = "X-From-Cache"
+
+const (
+	// responseTimeHeader holds time when response was received.
+	responseTimeHeader = "X-Cache-Response-Time"
+	// variedPrefix is prefix of headers that hold values of request headers
+	// listed in Vary response header.
+	variedPrefix = "X-Cache-Varied-"
+)
+
+// cacheConfigKey is private type to be used for storing information in context
+// and be sure that there will be no collision with other keys
+type cacheConfigKey string
+
+var (
+	bypassKey  cacheConfigKey = "bypass"
+	refreshKey cacheConfigKey = "refresh"
+)
+
+// Bypass instructs cache not to be used for request. Response is neither
+// read from nor written to cache.
+func Bypass() c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, bypassKey, true)
+	})
+}
+
+// Refresh instructs cache to ignore cached response and send request to
+// server. Received response is stored in cache.
+func Refresh() c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, refreshKey, true)
+	})
+}
+
+func isSet(ctx context.Context, key cacheConfigKey) bool {
+	value, _ := ctx.Value(key).(bool)
+	return value
+}
+
+// Enable modifies provided client so that its responses are cached in
+// provided store. Original transport is still used for sending requests.
+// If client transport already caches responses, client is not modified.
+func Enable(client *http.Client, store Store) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = NewTransport(next, store)
+}
+
+// NewTransport returns RoundTripper that wraps around provided RoundTripper
+// and caches responses in provided store.
+func NewTransport(next http.RoundTripper, store Store) http.RoundTripper {
+	return &transport{
+		next:  next,
+		store: store,
+		now:   time.Now,
+	}
+}
+
+type transport struct {
+	next  http.RoundTripper
+	store Store
+	now   func() time.Time
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if isSet(r.Context(), bypassKey) {
+		return t.next.RoundTrip(r)
+	}
+	key := r.URL.String()
+	if r.Method != "GET" && r.Method != "" {
+		resp, err := t.next.RoundTrip(r)
+		if err == nil && !isSafe(r.Method) && resp.StatusCode < 400 {
+			t.store.Delete(key)
+		}
+		return resp, err
+	}
+	reqControl := parseCacheControl(r.Header)
+	if reqControl.has("no-store") {
+		return t.next.RoundTrip(r)
+	}
+
+	var cached *entry
+	if !isSet(r.Context(), refreshKey) {
+		cached = t.load(key, r)
+	}
+	req := r
+	if cached != nil {
+		if t.fresh(cached, reqControl) {
+			return cached.response(), nil
+		}
+		req = conditionalRequest(r, cached.resp.Header)
+		if req == nil {
+			// no validators, cached response is useless
+			cached = nil
+			req = r
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		// stale response can be used when server can not be reached, unless
+		// it has to be revalidated
+		if cached != nil && !parseCacheControl(cached.resp.Header).has("must-revalidate", "no-cache") {
+			resp := cached.response()
+			resp.Header.Add("Warning", `111 - "Revalidation Failed"`)
+			return resp, nil
+		}
+		return nil, err
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		for k, v := range resp.Header {
+			if k != "Content-Length" && k != "Transfer-Encoding" {
+				cached.resp.Header[k] = v
+			}
+		}
+		cached.time = t.now()
+		t.save(key, r, cached)
+		return cached.response(), nil
+	}
+
+	if storable(reqControl, resp) {
+		received := t.now()
+		resp.Body = &cachingBody{ReadCloser: resp.Body, done: func(body []byte) {
+			t.save(key, r, &entry{resp: resp, body: body, time: received})
+		}}
+	}
+	return resp, nil
+}
+
+// fresh checks if cached response can be used without revalidation.
+func (t *transport) fresh(e *entry, reqControl cacheControl) bool {
+	if reqControl.has("no-cache") {
+		return false
+	}
+	respControl := parseCacheControl(e.resp.Header)
+	if respControl.has("no-cache") {
+		return false
+	}
+	age := e.age(t.now())
+	if maxAge, ok := reqControl.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	return freshnessLifetime(e.resp.Header, respControl, e.time) > age
+}
+
+// load returns cached response for provided request or nil if there is no
+// cached response or it does not match request headers listed in Vary.
+func (t *transport) load(key string, r *http.Request) *entry {
+	data, ok := t.store.Get(key)
+	if !ok {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), r)
+	if err != nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil
+	}
+	for _, field := range varyFields(resp.Header) {
+		if field == "*" || r.Header.Get(field) != resp.Header.Get(variedPrefix+field) {
+			return nil
+		}
+	}
+	received, err := time.Parse(time.RFC3339Nano, resp.Header.Get(responseTimeHeader))
+	if err != nil {
+		return nil
+	}
+	for k := range resp.Header {
+		if k == responseTimeHeader || strings.HasPrefix(k, variedPrefix) {
+			resp.Header.Del(k)
+		}
+	}
+	return &entry{resp: resp, body: body, time: received}
+}
+
+// save stores provided entry with values of request headers listed in Vary.
+func (t *transport) save(key string, r *http.Request, e *entry) {
+	resp := *e.resp
+	resp.Header = make(http.Header, len(e.resp.Header)+1)
+	for k, v := range e.resp.Header {
+		if k != XFromCache {
+			resp.Header[k] = v
+		}
+	}
+	for _, field := range varyFields(e.resp.Header) {
+		resp.Header.Set(variedPrefix+field, r.Header.Get(field))
+	}
+	resp.Header.Set(responseTimeHeader, e.time.Format(time.RFC3339Nano))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(e.body))
+	resp.ContentLength = int64(len(e.body))
+	resp.TransferEncoding = nil
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Transfer-Encoding")
+	data, err := httputil.DumpResponse(&resp, true)
+	if err != nil {
+		return
+	}
+	t.store.Set(key, data)
+}
+
+// entry is cached response.
+type entry struct {
+	resp *http.Response
+	body []byte
+	// time is when response was received or last revalidated
+	time time.Time
+}
+
+// response returns response that can be returned to caller.
+func (e *entry) response() *http.Response {
+	resp := *e.resp
+	resp.Header = make(http.Header, len(e.resp.Header)+1)
+	for k, v := range e.resp.Header {
+		resp.Header[k] = v
+	}
+	resp.Header.Set(XFromCache, "1")
+	resp.Body = ioutil.NopCloser(bytes.NewReader(e.body))
+	resp.ContentLength = int64(len(e.body))
+	return &resp
+}
+
+// age returns current age of response as defined in RFC 7234, section 4.2.3.
+func (e *entry) age(now time.Time) time.Duration {
+	age := time.Duration(0)
+	if date, err := http.ParseTime(e.resp.Header.Get("Date")); err == nil && e.time.After(date) {
+		age = e.time.Sub(date)
+	}
+	if seconds, err := strconv.ParseInt(e.resp.Header.Get("Age"), 10, 64); err == nil && seconds >= 0 {
+		if d := time.Duration(seconds) * time.Second; d > age {
+			age = d
+		}
+	}
+	return age + now.Sub(e.time)
+}
+
+// freshnessLifetime returns how long response is fresh, as defined in RFC 7234,
+// section 4.2.1. Heuristic freshness is not used.
+func freshnessLifetime(header http.Header, control cacheControl, received time.Time) time.Duration {
+	if maxAge, ok := control.seconds("max-age"); ok {
+		return maxAge
+	}
+	if header.Get("Expires") == "" {
+		return 0
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		// invalid dates represent time in the past
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = received
+	}
+	return expires.Sub(date)
+}
+
+// storable checks if response can be stored in cache.
+func storable(reqControl cacheControl, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 200, 203, 300, 301, 404, 410:
+	default:
+		return false
+	}
+	respControl := parseCacheControl(resp.Header)
+	if respControl.has("no-store") {
+		return false
+	}
+	if _, ok := respControl.seconds("max-age"); ok {
+		return true
+	}
+	return resp.Header.Get("Expires") != "" || resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// conditionalRequest returns copy of provided request with validators from
+// cached response headers or nil if cached response has no validators.
+func conditionalRequest(r *http.Request, cached http.Header) *http.Request {
+	etag, lastModified := cached.Get("ETag"), cached.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	req := r.WithContext(r.Context())
+	req.Header = make(http.Header, len(r.Header)+2)
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	return req
+}
+
+// varyFields returns canonical names of headers listed in Vary header.
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, value := range header["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	return fields
+}
+
+func isSafe(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// cacheControl holds parsed directives of Cache-Control header.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	control := cacheControl{}
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			parts := strings.SplitN(directive, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(parts[0]))
+			if len(parts) == 2 {
+				control[name] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+			} else {
+				control[name] = ""
+			}
+		}
+	}
+	return control
+}
+
+// has checks if any of provided directives is present.
+func (cc cacheControl) has(directives ...string) bool {
+	for _, d := range directives {
+		if _, ok := cc[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds returns value of directive that holds number of seconds.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cachingBody is response body that collects content while it is read and
+// calls done once it is read to the end.
+type cachingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf.Bytes()) })
+	}
+	return n, err
+}
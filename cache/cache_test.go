@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+var testNow = time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// serverRoundTripper answers requests using provided function and records them.
+type serverRoundTripper struct {
+	requests []*http.Request
+	respond  func(r *http.Request) (*http.Response, error)
+}
+
+func (rt *serverRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, r)
+	return rt.respond(r)
+}
+
+func newResponse(status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func newTestTransport(server *serverRoundTripper) (*transport, *time.Time) {
+	now := testNow
+	t := NewTransport(server, NewMemoryStore(0)).(*transport)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func get(t *testing.T, rt http.RoundTripper, url string, header http.Header) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal("RoundTrip returned error:", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, string(body)
+}
+
+func TestMaxAge(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{
+			"Cache-Control": {"max-age=60"},
+			"Date":          {testNow.Format(http.TimeFormat)},
+		}, "content"), nil
+	}}
+	rt, now := newTestTransport(server)
+
+	resp, body := get(t, rt, "http://example.com/config", nil)
+	if resp.Header.Get(XFromCache) != "" || body != "content" {
+		t.Errorf("Wrong first response. Got: %s, from cache: %s.", body, resp.Header.Get(XFromCache))
+	}
+	*now = now.Add(30 * time.Second)
+	resp, body = get(t, rt, "http://example.com/config", nil)
+	if resp.Header.Get(XFromCache) != "1" || body != "content" {
+		t.Errorf("Fresh response not served from cache. Got: %s, from cache: %s.", body, resp.Header.Get(XFromCache))
+	}
+	if len(server.requests) != 1 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 1.", len(server.requests))
+	}
+
+	// request can demand fresher response
+	get(t, rt, "http://example.com/config", http.Header{"Cache-Control": {"max-age=10"}})
+	if len(server.requests) != 2 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 2.", len(server.requests))
+	}
+
+	*now = now.Add(61 * time.Second)
+	resp, _ = get(t, rt, "http://example.com/config", nil)
+	if resp.Header.Get(XFromCache) != "" || len(server.requests) != 3 {
+		t.Error("Stale response served from cache.")
+	}
+}
+
+func TestExpires(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{
+			"Date":    {testNow.Format(http.TimeFormat)},
+			"Expires": {testNow.Add(time.Minute).Format(http.TimeFormat)},
+		}, "content"), nil
+	}}
+	rt, now := newTestTransport(server)
+	get(t, rt, "http://example.com/", nil)
+	*now = now.Add(59 * time.Second)
+	if resp, _ := get(t, rt, "http://example.com/", nil); resp.Header.Get(XFromCache) != "1" {
+		t.Error("Fresh response not served from cache.")
+	}
+	*now = now.Add(2 * time.Second)
+	if resp, _ := get(t, rt, "http://example.com/", nil); resp.Header.Get(XFromCache) != "" {
+		t.Error("Expired response served from cache.")
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{"Cache-Control": {"no-store, max-age=60"}}, "content"), nil
+	}}
+	rt, _ := newTestTransport(server)
+	for i := 0; i < 2; i++ {
+		get(t, rt, "http://example.com/", nil)
+	}
+	if len(server.requests) != 2 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 2.", len(server.requests))
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			return newResponse(304, http.Header{"Cache-Control": {"max-age=60"}}, ""), nil
+		}
+		return newResponse(200, http.Header{
+			"Cache-Control": {"no-cache"},
+			"Etag":          {`"v1"`},
+			"Last-Modified": {testNow.Format(http.TimeFormat)},
+		}, "content"), nil
+	}}
+	rt, _ := newTestTransport(server)
+	get(t, rt, "http://example.com/", nil)
+
+	resp, body := get(t, rt, "http://example.com/", nil)
+	if resp.StatusCode != 200 || body != "content" || resp.Header.Get(XFromCache) != "1" {
+		t.Errorf("Wrong revalidated response. Got: %d %s.", resp.StatusCode, body)
+	}
+	req := server.requests[1]
+	if req.Header.Get("If-None-Match") != `"v1"` || req.Header.Get("If-Modified-Since") == "" {
+		t.Errorf("Wrong conditional request headers: %v.", req.Header)
+	}
+	if resp.Header.Get("Cache-Control") != "max-age=60" {
+		t.Errorf("Headers not updated from 304 response. Got: %v.", resp.Header)
+	}
+
+	// after revalidation response is fresh
+	get(t, rt, "http://example.com/", nil)
+	if len(server.requests) != 2 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 2.", len(server.requests))
+	}
+}
+
+func TestRevalidationFailed(t *testing.T) {
+	fail := false
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return newResponse(200, http.Header{"Etag": {`"v1"`}}, "content"), nil
+	}}
+	rt, _ := newTestTransport(server)
+	get(t, rt, "http://example.com/", nil)
+	fail = true
+	resp, body := get(t, rt, "http://example.com/", nil)
+	if body != "content" || resp.Header.Get("Warning") == "" {
+		t.Errorf("Stale response not served when server failed. Got: %s, %v.", body, resp.Header)
+	}
+}
+
+func TestVary(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{
+			"Cache-Control": {"max-age=60"},
+			"Vary":          {"Accept-Language"},
+		}, r.Header.Get("Accept-Language")), nil
+	}}
+	rt, _ := newTestTransport(server)
+	get(t, rt, "http://example.com/", http.Header{"Accept-Language": {"en"}})
+	if resp, body := get(t, rt, "http://example.com/", http.Header{"Accept-Language": {"en"}}); resp.Header.Get(XFromCache) != "1" || body != "en" {
+		t.Errorf("Matching response not served from cache. Got: %s.", body)
+	}
+	if resp, body := get(t, rt, "http://example.com/", http.Header{"Accept-Language": {"sr"}}); resp.Header.Get(XFromCache) != "" || body != "sr" {
+		t.Errorf("Response for different Accept-Language served from cache. Got: %s.", body)
+	}
+}
+
+func TestUnsafeInvalidates(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{"Cache-Control": {"max-age=60"}}, "content"), nil
+	}}
+	rt, _ := newTestTransport(server)
+	get(t, rt, "http://example.com/item", nil)
+	req, _ := http.NewRequest("PUT", "http://example.com/item", strings.NewReader("new"))
+	rt.RoundTrip(req)
+	if resp, _ := get(t, rt, "http://example.com/item", nil); resp.Header.Get(XFromCache) != "" {
+		t.Error("Response served from cache after it was invalidated.")
+	}
+}
+
+func TestBypassAndRefresh(t *testing.T) {
+	server := &serverRoundTripper{respond: func(r *http.Request) (*http.Response, error) {
+		return newResponse(200, http.Header{"Cache-Control": {"max-age=60"}}, "content"), nil
+	}}
+	rt, _ := newTestTransport(server)
+	for _, data := range []struct {
+		Middleware        cliware.Middleware
+		ExpectedFromCache string
+		ExpectedRequests  int
+	}{
+		{Middleware: Bypass(), ExpectedFromCache: "", ExpectedRequests: 1},
+		// bypassed response was not stored
+		{Middleware: Refresh(), ExpectedFromCache: "", ExpectedRequests: 2},
+		// refreshed response was stored
+		{Middleware: cliware.NewChain(), ExpectedFromCache: "1", ExpectedRequests: 2},
+	} {
+		handler := data.Middleware.Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return rt.RoundTrip(req)
+		}))
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		resp, err := handler.Handle(req)
+		if err != nil {
+			t.Fatal("Handle returned error:", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		if resp.Header.Get(XFromCache) != data.ExpectedFromCache {
+			t.Errorf("Wrong X-From-Cache. Got: %q, expected: %q.", resp.Header.Get(XFromCache), data.ExpectedFromCache)
+		}
+		if len(server.requests) != data.ExpectedRequests {
+			t.Errorf("Wrong number of requests. Got: %d, expected: %d.", len(server.requests), data.ExpectedRequests)
+		}
+	}
+}
+
+func TestEnable(t *testing.T) {
+	store := NewMemoryStore(10)
+	for _, client := range []*http.Client{
+		{},
+		{Transport: http.DefaultTransport},
+		{Transport: NewTransport(http.DefaultTransport, store)},
+	} {
+		Enable(client, store)
+		if _, ok := client.Transport.(*transport); !ok {
+			t.Errorf("Wrong transport, expected cache transport, got: %T.", client.Transport)
+		}
+	}
+}
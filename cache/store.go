@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store keeps serialized responses. Implementations have to be safe for
+// concurrent use.
+type Store interface {
+	// Get returns value stored with provided key and true, or false if
+	// there is no such value.
+	Get(key string) ([]byte, bool)
+	// Set stores value with provided key.
+	Set(key string, value []byte)
+	// Delete removes value with provided key.
+	Delete(key string)
+}
+
+// MemoryStore is Store that keeps values in memory. Once number of values
+// reaches limit, least recently used value is removed.
+type MemoryStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryStore creates new MemoryStore that keeps at most provided number
+// of values. If maxEntries is not positive, number of values is not limited.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get is implementation of Store interface.
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+// Set is implementation of Store interface.
+func (s *MemoryStore) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*memoryEntry).value = value
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, value: value})
+	if s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Delete is implementation of Store interface.
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, key)
+	}
+}
+
+// Len returns number of values in store.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// DiskStore is Store that keeps every value in separate file in directory.
+// Errors during reading and writing files are ignored, which results in
+// values not being cached.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates new DiskStore that keeps files in provided directory.
+// Directory is created if it does not exist.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get is implementation of Store interface.
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	value, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set is implementation of Store interface.
+func (s *DiskStore) Set(key string, value []byte) {
+	// write to temporary file first, so readers never see partial value
+	f, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), s.path(key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete is implementation of Store interface.
+func (s *DiskStore) Delete(key string) {
+	os.Remove(s.path(key))
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
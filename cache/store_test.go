@@ -0,0 +1,63 @@
+package cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/cache"
+)
+
+func testStore(t *testing.T, store cache.Store) {
+	if _, ok := store.Get("missing"); ok {
+		t.Error("Store returned value for missing key.")
+	}
+	store.Set("key", []byte("value"))
+	if value, ok := store.Get("key"); !ok || string(value) != "value" {
+		t.Errorf("Wrong value. Got: %s, expected: value.", value)
+	}
+	store.Set("key", []byte("other"))
+	if value, _ := store.Get("key"); string(value) != "other" {
+		t.Errorf("Wrong value. Got: %s, expected: other.", value)
+	}
+	store.Delete("key")
+	if _, ok := store.Get("key"); ok {
+		t.Error("Store returned deleted value.")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, cache.NewMemoryStore(0))
+}
+
+func TestMemoryStoreLRU(t *testing.T) {
+	store := cache.NewMemoryStore(2)
+	store.Set("a", []byte("a"))
+	store.Set("b", []byte("b"))
+	store.Get("a")
+	store.Set("c", []byte("c"))
+	if _, ok := store.Get("b"); ok {
+		t.Error("Least recently used value not removed.")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("Value %s removed.", key)
+		}
+	}
+	if store.Len() != 2 {
+		t.Errorf("Wrong store size. Got: %d, expected: 2.", store.Len())
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := cache.NewDiskStore(dir)
+	if err != nil {
+		t.Fatal("Unable to create store:", err)
+	}
+	testStore(t, store)
+}
@@ -0,0 +1,311 @@
+// Package circuitbreaker contains circuit breaker that stops sending requests
+// to backends that keep failing. It can be used as cliware middleware or as
+// RoundTripper that wraps other RoundTripper.
+//
+// Circuit breaker for each key (by default request host) starts closed and
+// lets all requests through. Once ratio of failed requests within rolling
+// window reaches threshold, circuit opens and all requests fail immediately
+// with ErrCircuitOpen. After cool-down period circuit becomes half-open and
+// lets limited number of probe requests through. If they all succeed, circuit
+// closes again, otherwise it opens for another cool-down period.
+package circuitbreaker
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	c "github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/retry"
+)
+
+// ErrCircuitOpen is returned for requests that are rejected because circuit
+// is open.
+var ErrCircuitOpen = errors.New("circuitbreaker: circuit is open")
+
+// State is state of single circuit.
+type State int
+
+// States of circuit.
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+// String returns name of state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var (
+	defaultThreshold      = 0.5
+	defaultMinRequests    = 10
+	defaultWindow         = 10 * time.Second
+	defaultCoolDown       = 30 * time.Second
+	defaultHalfOpenProbes = 1
+)
+
+// Config holds configuration of circuit breaker. Zero values are replaced
+// with defaults.
+type Config struct {
+	// Classifier determines which requests are failures. Same classifiers
+	// as for retry are used, default is retry.ErrorOr500Plus.
+	Classifier retry.Classifier
+	// FailureThreshold is ratio of failed requests (between 0 and 1) within
+	// window that opens circuit. Default is 0.5.
+	FailureThreshold float64
+	// MinRequests is minimal number of requests within window before circuit
+	// can be opened. Default is 10.
+	MinRequests int
+	// Window is duration of rolling window in which requests are counted.
+	// Default is 10 seconds.
+	Window time.Duration
+	// CoolDown is duration for which circuit stays open before it lets probe
+	// requests through. Default is 30 seconds.
+	CoolDown time.Duration
+	// HalfOpenProbes is number of requests let through while circuit is
+	// half-open. All of them have to succeed for circuit to close. Default
+	// is 1.
+	HalfOpenProbes int
+	// KeyFunc returns key of circuit for request. Requests with same key
+	// share circuit. Default is request host.
+	KeyFunc func(*http.Request) string
+}
+
+// CircuitBreaker holds circuits for all keys. It is safe for concurrent use.
+type CircuitBreaker struct {
+	config Config
+	now    func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// New creates new CircuitBreaker with provided configuration.
+func New(config Config) *CircuitBreaker {
+	if config.Classifier == nil {
+		config.Classifier = retry.ErrorOr500Plus
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultThreshold
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = defaultMinRequests
+	}
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = defaultCoolDown
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = defaultHalfOpenProbes
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = hostKey
+	}
+	return &CircuitBreaker{
+		config:   config,
+		now:      time.Now,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// hostKey is key function that returns host of request.
+func hostKey(req *http.Request) string {
+	if req.URL != nil && req.URL.Host != "" {
+		return req.URL.Host
+	}
+	return req.Host
+}
+
+// State returns current state of circuit with provided key.
+func (cb *CircuitBreaker) State(key string) State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	ct, ok := cb.circuits[key]
+	if !ok {
+		return Closed
+	}
+	ct.update(cb.now(), &cb.config)
+	return ct.state
+}
+
+// Middleware returns middleware that protects requests with circuit breaker.
+func (cb *CircuitBreaker) Middleware() c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return cb.do(req, next.Handle)
+		})
+	})
+}
+
+// do sends request using provided function if circuit allows it and records
+// result.
+func (cb *CircuitBreaker) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	key := cb.config.KeyFunc(req)
+	generation, err := cb.allow(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req)
+	if req.Context().Err() != nil {
+		// caller gave up on request, so result says nothing about destination
+		cb.release(key, generation)
+		return resp, err
+	}
+	cb.record(key, generation, !cb.config.Classifier(resp, err))
+	return resp, err
+}
+
+// allow checks if request for provided key can be sent and returns
+// generation of circuit that has to be passed to record.
+func (cb *CircuitBreaker) allow(key string) (uint64, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	ct, ok := cb.circuits[key]
+	if !ok {
+		ct = &circuit{}
+		cb.circuits[key] = ct
+	}
+	ct.update(cb.now(), &cb.config)
+	switch ct.state {
+	case Open:
+		return 0, ErrCircuitOpen
+	case HalfOpen:
+		if ct.probes >= cb.config.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		ct.probes++
+	}
+	return ct.generation, nil
+}
+
+// record records result of request sent for provided key.
+func (cb *CircuitBreaker) record(key string, generation uint64, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	ct := cb.circuits[key]
+	// results of requests sent before circuit changed state are not relevant
+	if ct.generation != generation {
+		return
+	}
+	now := cb.now()
+	switch ct.state {
+	case Closed:
+		ct.window.add(now, cb.config.Window, success)
+		total, failures := ct.window.counts(now, cb.config.Window)
+		if total >= cb.config.MinRequests && float64(failures) >= cb.config.FailureThreshold*float64(total) {
+			ct.transition(Open, now)
+		}
+	case HalfOpen:
+		if !success {
+			ct.transition(Open, now)
+			return
+		}
+		ct.successes++
+		if ct.successes >= cb.config.HalfOpenProbes {
+			ct.transition(Closed, now)
+		}
+	}
+}
+
+// release returns probe taken by request whose result is not recorded, so
+// that it can be used by another request.
+func (cb *CircuitBreaker) release(key string, generation uint64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	ct := cb.circuits[key]
+	if ct.generation == generation && ct.state == HalfOpen && ct.probes > 0 {
+		ct.probes--
+	}
+}
+
+// circuit is state of circuit for single key.
+type circuit struct {
+	state      State
+	generation uint64
+	openedAt   time.Time
+	probes     int
+	successes  int
+	window     window
+}
+
+// update moves open circuit to half-open state once cool-down passes.
+func (ct *circuit) update(now time.Time, config *Config) {
+	if ct.state == Open && now.Sub(ct.openedAt) >= config.CoolDown {
+		ct.transition(HalfOpen, now)
+	}
+}
+
+func (ct *circuit) transition(state State, now time.Time) {
+	ct.state = state
+	ct.generation++
+	ct.probes = 0
+	ct.successes = 0
+	ct.window = window{}
+	if state == Open {
+		ct.openedAt = now
+	}
+}
+
+// windowBuckets is number of buckets rolling window is divided into.
+const windowBuckets = 10
+
+// window counts requests and failures within rolling window.
+type window struct {
+	epochs   [windowBuckets]int64
+	total    [windowBuckets]int
+	failures [windowBuckets]int
+}
+
+func (w *window) add(now time.Time, size time.Duration, success bool) {
+	i := w.bucket(now, size)
+	w.total[i]++
+	if !success {
+		w.failures[i]++
+	}
+}
+
+func (w *window) counts(now time.Time, size time.Duration) (total, failures int) {
+	w.bucket(now, size)
+	for i := range w.epochs {
+		total += w.total[i]
+		failures += w.failures[i]
+	}
+	return total, failures
+}
+
+// bucket returns index of bucket for provided time, resetting buckets that
+// fell out of window.
+func (w *window) bucket(now time.Time, size time.Duration) int {
+	bucketSize := int64(size / windowBuckets)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	epoch := now.UnixNano() / bucketSize
+	for i := range w.epochs {
+		if w.epochs[i] <= epoch-windowBuckets {
+			w.epochs[i] = 0
+			w.total[i] = 0
+			w.failures[i] = 0
+		}
+	}
+	current := int(epoch % windowBuckets)
+	if w.epochs[current] != epoch {
+		w.epochs[current] = epoch
+		w.total[current] = 0
+		w.failures[current] = 0
+	}
+	return current
+}
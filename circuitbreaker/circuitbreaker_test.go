@@ -0,0 +1,202 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// fakeClock is manually advanced clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestBreaker(config Config) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	cb := New(config)
+	cb.now = clock.Now
+	return cb, clock
+}
+
+// createHandler returns handler that returns response with status code
+// pointed to by provided status, or error if status is zero.
+func createHandler(status *int) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if *status == 0 {
+			return nil, errors.New("connection failed")
+		}
+		return &http.Response{StatusCode: *status, Request: req}, nil
+	})
+}
+
+func send(handler cliware.Handler, host string) error {
+	req := cliware.EmptyRequest()
+	req.URL.Host = host
+	_, err := handler.Handle(req)
+	return err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cb, clock := newTestBreaker(Config{
+		FailureThreshold: 0.5,
+		MinRequests:      4,
+		CoolDown:         time.Minute,
+		HalfOpenProbes:   2,
+	})
+	status := 200
+	handler := cb.Middleware().Exec(createHandler(&status))
+
+	// not enough failures to open circuit
+	for _, s := range []int{200, 200, 500} {
+		status = s
+		send(handler, "example.com")
+	}
+	if state := cb.State("example.com"); state != Closed {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, Closed)
+	}
+
+	status = 0
+	send(handler, "example.com")
+	if state := cb.State("example.com"); state != Open {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, Open)
+	}
+	if err := send(handler, "example.com"); err != ErrCircuitOpen {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ErrCircuitOpen)
+	}
+	// other hosts are not affected
+	if err := send(handler, "example.org"); err == ErrCircuitOpen {
+		t.Error("Circuit for other host is open.")
+	}
+
+	// after cool-down, probes are let through and failed probe opens circuit
+	clock.now = clock.now.Add(time.Minute)
+	if state := cb.State("example.com"); state != HalfOpen {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, HalfOpen)
+	}
+	if err := send(handler, "example.com"); err == ErrCircuitOpen {
+		t.Error("Probe request rejected.")
+	}
+	if state := cb.State("example.com"); state != Open {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, Open)
+	}
+
+	// successful probes close circuit
+	clock.now = clock.now.Add(time.Minute)
+	status = 200
+	for i := 0; i < 2; i++ {
+		if err := send(handler, "example.com"); err != nil {
+			t.Error("Probe request returned error:", err)
+		}
+	}
+	if state := cb.State("example.com"); state != Closed {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, Closed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	cb, clock := newTestBreaker(Config{MinRequests: 1, CoolDown: time.Second, HalfOpenProbes: 1})
+	if _, err := cb.allow("key"); err != nil {
+		t.Fatal("Request rejected:", err)
+	}
+	cb.record("key", 0, false)
+	clock.now = clock.now.Add(time.Second)
+
+	generation, err := cb.allow("key")
+	if err != nil {
+		t.Fatal("Probe rejected:", err)
+	}
+	if _, err := cb.allow("key"); err != ErrCircuitOpen {
+		t.Errorf("Probe over limit not rejected. Got: %v, expected: %v.", err, ErrCircuitOpen)
+	}
+	cb.record("key", generation, true)
+	if state := cb.State("key"); state != Closed {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, Closed)
+	}
+}
+
+func TestCircuitBreakerCancelled(t *testing.T) {
+	cb, clock := newTestBreaker(Config{MinRequests: 1, CoolDown: time.Second, HalfOpenProbes: 1})
+	handler := cb.Middleware().Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sendCancelled := func() error {
+		req := cliware.EmptyRequest().WithContext(ctx)
+		req.URL.Host = "example.com"
+		_, err := handler.Handle(req)
+		return err
+	}
+
+	// requests cancelled by caller are not failures
+	for i := 0; i < 3; i++ {
+		if err := sendCancelled(); err != context.Canceled {
+			t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+		}
+	}
+	if state := cb.State("example.com"); state != Closed {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, Closed)
+	}
+
+	// cancelled probe does not close or re-open circuit and is returned
+	generation, _ := cb.allow("example.com")
+	cb.record("example.com", generation, false)
+	clock.now = clock.now.Add(time.Second)
+	sendCancelled()
+	if state := cb.State("example.com"); state != HalfOpen {
+		t.Fatalf("Wrong state. Got: %s, expected: %s.", state, HalfOpen)
+	}
+	if _, err := cb.allow("example.com"); err != nil {
+		t.Error("Probe rejected after cancelled probe:", err)
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	cb, clock := newTestBreaker(Config{MinRequests: 2, Window: 10 * time.Second})
+	generation, _ := cb.allow("key")
+	cb.record("key", generation, false)
+	// first failure falls out of window before second one is recorded
+	clock.now = clock.now.Add(11 * time.Second)
+	generation, _ = cb.allow("key")
+	cb.record("key", generation, false)
+	if state := cb.State("key"); state != Closed {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, Closed)
+	}
+	generation, _ = cb.allow("key")
+	cb.record("key", generation, false)
+	if state := cb.State("key"); state != Open {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, Open)
+	}
+}
+
+func TestCustomKeyFunc(t *testing.T) {
+	cb, _ := newTestBreaker(Config{
+		MinRequests: 1,
+		KeyFunc:     func(req *http.Request) string { return "all" },
+	})
+	status := 500
+	handler := cb.Middleware().Exec(createHandler(&status))
+	send(handler, "example.com")
+	if err := send(handler, "example.org"); err != ErrCircuitOpen {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ErrCircuitOpen)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for state, expected := range map[State]string{
+		Closed:    "closed",
+		Open:      "open",
+		HalfOpen:  "half-open",
+		State(42): "unknown",
+	} {
+		if state.String() != expected {
+			t.Errorf("Wrong state name. Got: %s, expected: %s.", state.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package circuitbreaker
+
+import "net/http"
+
+// Enable modifies provided client so that all its requests are protected by
+// provided circuit breaker. Original transport is wrapped and still used for
+// sending requests. If client transport is already protected by circuit
+// breaker, client is not modified.
+func Enable(client *http.Client, cb *CircuitBreaker) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = NewTransport(next, cb)
+}
+
+// NewTransport returns RoundTripper that wraps around provided RoundTripper
+// and sends requests only if circuit breaker allows it.
+func NewTransport(next http.RoundTripper, cb *CircuitBreaker) http.RoundTripper {
+	return &transport{
+		next: next,
+		cb:   cb,
+	}
+}
+
+type transport struct {
+	next http.RoundTripper
+	cb   *CircuitBreaker
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.cb.do(r, t.next.RoundTrip)
+}
@@ -0,0 +1,50 @@
+package circuitbreaker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/delicb/cliware"
+)
+
+type mockRoundTripper struct {
+	calledCount int
+	response    *http.Response
+	err         error
+}
+
+func (rt *mockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.calledCount++
+	return rt.response, rt.err
+}
+
+func TestEnable(t *testing.T) {
+	cb := New(Config{})
+	for _, client := range []*http.Client{
+		{},
+		{
+			Transport: http.DefaultTransport,
+		},
+		{
+			Transport: NewTransport(http.DefaultTransport, cb),
+		},
+	} {
+		Enable(client, cb)
+		if _, ok := client.Transport.(*transport); !ok {
+			t.Errorf("Wrong transport, expected circuit breaker transport, got: %T.", client.Transport)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	mock := &mockRoundTripper{response: &http.Response{StatusCode: 503}}
+	rt := NewTransport(mock, New(Config{MinRequests: 2}))
+	for i := 0; i < 5; i++ {
+		req := cliware.EmptyRequest()
+		req.URL.Host = "example.com"
+		rt.RoundTrip(req)
+	}
+	if mock.calledCount != 2 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 2.", mock.calledCount)
+	}
+}
@@ -0,0 +1,166 @@
+// Package coalesce contains RoundTripper that merges concurrent identical GET
+// and HEAD requests into single request to server.
+//
+// While request is in flight, all identical requests wait for its response
+// instead of sending their own. Every caller gets its own copy of response,
+// with its own body. Requests are identical if they have same method, URL,
+// credentials (Authorization and Cookie headers) and values of selected
+// headers. Upstream request is cancelled only once all callers waiting for it
+// gave up.
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Enable modifies provided client so that identical concurrent requests are
+// coalesced. Values of provided headers are part of request identity.
+// Original transport is still used for sending requests. If client transport
+// already coalesces requests, client is not modified.
+func Enable(client *http.Client, headers ...string) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = NewTransport(next, headers...)
+}
+
+// credentialHeaders are headers that are always part of request identity, so
+// that response is never shared between callers with different credentials.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// NewTransport returns RoundTripper that wraps around provided RoundTripper
+// and coalesces identical concurrent requests. Values of provided headers
+// (e.g. Accept) are part of request identity, in addition to credentials.
+func NewTransport(next http.RoundTripper, headers ...string) http.RoundTripper {
+	return &transport{
+		next:    next,
+		headers: append(append([]string(nil), credentialHeaders...), headers...),
+		calls:   make(map[string]*call),
+	}
+}
+
+type transport struct {
+	next    http.RoundTripper
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is request in flight.
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if (r.Method != "GET" && r.Method != "HEAD" && r.Method != "") ||
+		(r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0) {
+		return t.next.RoundTrip(r)
+	}
+	key := t.key(r)
+
+	t.mu.Lock()
+	cl, ok := t.calls[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(detachedContext{r.Context()})
+		cl = &call{done: make(chan struct{}), cancel: cancel}
+		t.calls[key] = cl
+		go t.do(key, cl, r.WithContext(ctx))
+	}
+	cl.waiters++
+	t.mu.Unlock()
+
+	select {
+	case <-cl.done:
+	case <-r.Context().Done():
+		t.mu.Lock()
+		cl.waiters--
+		if cl.waiters == 0 {
+			// nobody waits for abandoned call, so next caller starts new one
+			if t.calls[key] == cl {
+				delete(t.calls, key)
+			}
+			cl.cancel()
+		}
+		t.mu.Unlock()
+		return nil, r.Context().Err()
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	return cl.response(r), nil
+}
+
+// do sends request and reads whole response body, so it can be shared.
+func (t *transport) do(key string, cl *call, r *http.Request) {
+	defer func() {
+		t.mu.Lock()
+		if t.calls[key] == cl {
+			delete(t.calls, key)
+		}
+		t.mu.Unlock()
+		cl.cancel()
+		close(cl.done)
+	}()
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		cl.err = err
+		return
+	}
+	cl.body, cl.err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	cl.resp = resp
+}
+
+// response returns copy of shared response for provided request.
+func (cl *call) response(r *http.Request) *http.Response {
+	resp := *cl.resp
+	resp.Header = make(http.Header, len(cl.resp.Header))
+	for k, v := range cl.resp.Header {
+		resp.Header[k] = append([]string(nil), v...)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(cl.body))
+	resp.ContentLength = int64(len(cl.body))
+	resp.Request = r
+	return &resp
+}
+
+// key returns identity of request.
+func (t *transport) key(r *http.Request) string {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	parts := []string{method, r.URL.String()}
+	for _, h := range t.headers {
+		parts = append(parts, strings.Join(r.Header[http.CanonicalHeaderKey(h)], ","))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// detachedContext is context that keeps values of its parent, but is never
+// cancelled together with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
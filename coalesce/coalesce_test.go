@@ -0,0 +1,271 @@
+package coalesce
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingRoundTripper blocks every request until release is closed.
+type blockingRoundTripper struct {
+	release chan struct{}
+
+	mu        sync.Mutex
+	called    int
+	cancelled int
+}
+
+func (rt *blockingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.called++
+	rt.mu.Unlock()
+	select {
+	case <-rt.release:
+	case <-r.Context().Done():
+		rt.mu.Lock()
+		rt.cancelled++
+		rt.mu.Unlock()
+		return nil, r.Context().Err()
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"X-Call": {"1"}},
+		Body:       ioutil.NopCloser(strings.NewReader("shared " + r.URL.Path)),
+	}, nil
+}
+
+func (rt *blockingRoundTripper) stats() (int, int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.called, rt.cancelled
+}
+
+// waitForWaiters waits until request with provided key has provided number of
+// waiters.
+func waitForWaiters(t *testing.T, tr *transport, key string, waiters int) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		tr.mu.Lock()
+		cl, ok := tr.calls[key]
+		got := 0
+		if ok {
+			got = cl.waiters
+		}
+		tr.mu.Unlock()
+		if got == waiters {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wrong number of waiters. Got: %d, expected: %d.", got, waiters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	mock := &blockingRoundTripper{release: make(chan struct{})}
+	tr := NewTransport(mock, "Accept").(*transport)
+
+	var wg sync.WaitGroup
+	bodies := make(chan string, 10)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+			resp, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Error("RoundTrip returned error:", err)
+				return
+			}
+			// modifying own copy must not affect others
+			resp.Header.Set("X-Call", "modified")
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			bodies <- string(body)
+		}()
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	waitForWaiters(t, tr, tr.key(req), 5)
+
+	// different header value means different request
+	go func() {
+		req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+		req.Header.Set("Accept", "text/plain")
+		tr.RoundTrip(req)
+	}()
+	req.Header.Set("Accept", "text/plain")
+	waitForWaiters(t, tr, tr.key(req), 1)
+
+	close(mock.release)
+	wg.Wait()
+	close(bodies)
+	for body := range bodies {
+		if body != "shared /a" {
+			t.Errorf("Wrong body. Got: %s, expected: shared /a.", body)
+		}
+	}
+	if called, _ := mock.stats(); called != 2 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 2.", called)
+	}
+}
+
+func TestCoalesceCredentials(t *testing.T) {
+	mock := &blockingRoundTripper{release: make(chan struct{})}
+	tr := NewTransport(mock).(*transport)
+
+	var wg sync.WaitGroup
+	send := func(header, value string) {
+		req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tr.RoundTrip(req); err != nil {
+				t.Error("RoundTrip returned error:", err)
+			}
+		}()
+	}
+	// response must not be shared between callers with different credentials
+	send("", "")
+	send("Authorization", "Bearer first")
+	send("Authorization", "Bearer second")
+	send("Cookie", "session=first")
+
+	deadline := time.Now().Add(time.Second)
+	for called, _ := mock.stats(); called != 4; called, _ = mock.stats() {
+		if time.Now().After(deadline) {
+			t.Errorf("Wrong number of calls. Got: %d, expected: 4.", called)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(mock.release)
+	wg.Wait()
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	mock := &blockingRoundTripper{release: make(chan struct{})}
+	defer close(mock.release)
+	tr := NewTransport(mock).(*transport)
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{first, second} {
+		go func(ctx context.Context) {
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			_, err := tr.RoundTrip(req.WithContext(ctx))
+			errs <- err
+		}(ctx)
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	waitForWaiters(t, tr, tr.key(req), 2)
+
+	// upstream request is not cancelled while someone still waits for it
+	cancelFirst()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+	}
+	if _, cancelled := mock.stats(); cancelled != 0 {
+		t.Error("Upstream request cancelled while another caller waits for it.")
+	}
+	cancelSecond()
+	<-errs
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, cancelled := mock.stats(); cancelled == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Upstream request not cancelled after all callers gave up.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesceAfterCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var mu sync.Mutex
+	calls := 0
+	// first upstream request ignores cancellation and keeps running
+	mock := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		calls++
+		call := calls
+		mu.Unlock()
+		if call == 1 {
+			<-release
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	tr := NewTransport(mock).(*transport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		_, err := tr.RoundTrip(req.WithContext(ctx))
+		errs <- err
+	}()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	waitForWaiters(t, tr, tr.key(req), 1)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+	}
+
+	// new caller must not join abandoned call
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := tr.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal("RoundTrip returned error:", err)
+	}
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 2.", calls)
+	}
+}
+
+// roundTripperFunc is function that implements http.RoundTripper interface.
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNotCoalesced(t *testing.T) {
+	mock := &blockingRoundTripper{release: make(chan struct{})}
+	close(mock.release)
+	tr := NewTransport(mock)
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("data"))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Error("RoundTrip returned error:", err)
+	}
+	if called, _ := mock.stats(); called != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", called)
+	}
+}
+
+func TestEnable(t *testing.T) {
+	for _, client := range []*http.Client{
+		{},
+		{Transport: http.DefaultTransport},
+		{Transport: NewTransport(http.DefaultTransport)},
+	} {
+		Enable(client)
+		if _, ok := client.Transport.(*transport); !ok {
+			t.Errorf("Wrong transport, expected coalescing transport, got: %T.", client.Transport)
+		}
+	}
+}
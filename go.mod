@@ -1,3 +1,5 @@
-module "github.com/delicb/cliware-middlewares"
+module github.com/delicb/cliware-middlewares
 
-require "github.com/delicb/cliware" v0.1.0
+go 1.21
+
+require github.com/delicb/cliware v0.1.0
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// StdLogger returns Logger that writes entries to provided standard library
+// logger, one line per entry followed by headers and bodies, if present. If
+// provided logger is nil, standard logger is used.
+func StdLogger(l *log.Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, entry Entry) {
+		if l == nil {
+			log.Print(entry.String())
+			return
+		}
+		l.Print(entry.String())
+	})
+}
+
+// String returns human readable representation of entry.
+func (e Entry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", e.Method, e.URL)
+	if e.Err != nil {
+		fmt.Fprintf(&b, " error=%q", e.Err.Error())
+	} else {
+		fmt.Fprintf(&b, " status=%d", e.Status)
+	}
+	fmt.Fprintf(&b, " duration=%s request_size=%d response_size=%d", e.Duration, e.RequestSize, e.ResponseSize)
+	if e.Attempt > 0 {
+		fmt.Fprintf(&b, " attempt=%d", e.Attempt)
+	}
+	writeHeader(&b, "> ", e.RequestHeader)
+	if e.RequestBody != nil {
+		fmt.Fprintf(&b, "\n> %s", e.RequestBody)
+	}
+	writeHeader(&b, "< ", e.ResponseHeader)
+	if e.ResponseBody != nil {
+		fmt.Fprintf(&b, "\n< %s", e.ResponseBody)
+	}
+	return b.String()
+}
+
+// writeHeader writes provided header to builder sorted by key, each line
+// starting with provided prefix.
+func writeHeader(b *strings.Builder, prefix string, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(b, "\n%s%s: %s", prefix, key, strings.Join(header[key], ", "))
+	}
+}
@@ -0,0 +1,233 @@
+// Package logging contains middleware and RoundTripper that log requests and
+// responses through small Logger interface. Adapters for standard library
+// log and log/slog packages are provided.
+//
+// Each exchange is logged as single Entry that contains method, URL, status,
+// duration, request and response sizes and number of retry attempt, if
+// request was sent by retry RoundTripper. Optionally, headers and bodies (up
+// to configured size) are included as well. Credentials are never logged:
+// values of Authorization, Proxy-Authorization, Cookie and Set-Cookie
+// headers, password in URL and configured query parameters are redacted.
+//
+// Middleware logs request as it was set up by whole middleware chain. To log
+// every attempt made by retry RoundTripper, wrap transport that retry uses
+// with NewTransport instead.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	c "github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/retry"
+)
+
+// Redacted is value that replaces sensitive data in log entries.
+const Redacted = "REDACTED"
+
+var (
+	defaultMaxBodySize   = int64(4096)
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+)
+
+// Logger is interface that log entries are written to.
+type Logger interface {
+	Log(ctx context.Context, entry Entry)
+}
+
+// LoggerFunc is function that implements Logger interface.
+type LoggerFunc func(ctx context.Context, entry Entry)
+
+// Log calls f(ctx, entry).
+func (f LoggerFunc) Log(ctx context.Context, entry Entry) {
+	f(ctx, entry)
+}
+
+// Entry holds information about single request and its response.
+type Entry struct {
+	Method string
+	// URL is request URL with sensitive data redacted.
+	URL      string
+	Status   int
+	Duration time.Duration
+	// RequestSize and ResponseSize are sizes of bodies in bytes, -1 if
+	// unknown.
+	RequestSize  int64
+	ResponseSize int64
+	// Attempt is number of retry attempt, zero if request was not sent by
+	// retry RoundTripper.
+	Attempt int
+	Err     error
+
+	// Headers and bodies are set only if dumping is configured. Bodies are
+	// truncated to configured size.
+	RequestHeader  http.Header
+	ResponseHeader http.Header
+	RequestBody    []byte
+	ResponseBody   []byte
+}
+
+// Config holds configuration of logging.
+type Config struct {
+	// Logger receives log entries. Default is StdLogger(nil).
+	Logger Logger
+	// DumpHeaders indicates if request and response headers are logged.
+	DumpHeaders bool
+	// DumpBodies indicates if request and response bodies are logged. Request
+	// body can be logged only if request has GetBody set.
+	DumpBodies bool
+	// MaxBodySize is maximal number of bytes of each body that is logged.
+	// Default is 4096.
+	MaxBodySize int64
+	// RedactHeaders are additional headers whose values are redacted.
+	RedactHeaders []string
+	// RedactQuery are query parameters whose values are redacted.
+	RedactQuery []string
+}
+
+type logger struct {
+	config        Config
+	redactHeaders map[string]bool
+	redactQuery   map[string]bool
+}
+
+func newLogger(config Config) *logger {
+	if config.Logger == nil {
+		config.Logger = StdLogger(nil)
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMaxBodySize
+	}
+	l := &logger{
+		config:        config,
+		redactHeaders: make(map[string]bool),
+		redactQuery:   make(map[string]bool),
+	}
+	for _, h := range append(defaultRedactHeaders, config.RedactHeaders...) {
+		l.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, q := range config.RedactQuery {
+		l.redactQuery[q] = true
+	}
+	return l
+}
+
+// Middleware returns middleware that logs requests using provided
+// configuration.
+func Middleware(config Config) c.Middleware {
+	l := newLogger(config)
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return l.do(req, next.Handle)
+		})
+	})
+}
+
+// do sends request using provided function and logs request together with
+// its response.
+func (l *logger) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	start := time.Now()
+	resp, err := send(req)
+	duration := time.Since(start)
+
+	// request is inspected after it is sent, so that changes made by
+	// middlewares further in chain are visible
+	entry := Entry{
+		Method:       req.Method,
+		URL:          l.redactURL(req.URL),
+		Duration:     duration,
+		RequestSize:  requestSize(req),
+		ResponseSize: -1,
+		Attempt:      retry.Attempt(req.Context()),
+		Err:          err,
+	}
+	if l.config.DumpHeaders {
+		entry.RequestHeader = l.redactHeader(req.Header)
+	}
+	if l.config.DumpBodies && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			entry.RequestBody, _ = ioutil.ReadAll(io.LimitReader(body, l.config.MaxBodySize))
+			body.Close()
+		}
+	}
+	if resp != nil {
+		entry.Status = resp.StatusCode
+		entry.ResponseSize = resp.ContentLength
+		if l.config.DumpHeaders {
+			entry.ResponseHeader = l.redactHeader(resp.Header)
+		}
+		if l.config.DumpBodies && resp.Body != nil {
+			entry.ResponseBody = peekBody(resp, l.config.MaxBodySize)
+		}
+	}
+	l.config.Logger.Log(req.Context(), entry)
+	return resp, err
+}
+
+// requestSize returns size of request body or -1 if it is unknown.
+func requestSize(req *http.Request) int64 {
+	if req.ContentLength == 0 && req.Body != nil && req.Body != http.NoBody {
+		return -1
+	}
+	return req.ContentLength
+}
+
+// peekBody reads up to limit bytes from response body and replaces body with
+// one that returns them again, so response is not affected.
+func peekBody(resp *http.Response, limit int64) []byte {
+	prefix, _ := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+	return prefix
+}
+
+// peekedBody is response body which beginning was already read for logging.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// redactURL returns string representation of provided URL with password and
+// configured query parameters redacted.
+func (l *logger) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if _, ok := u.User.Password(); ok {
+		redacted.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	if len(l.redactQuery) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for key, values := range query {
+			if !l.redactQuery[key] {
+				continue
+			}
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// redactHeader returns copy of provided header with sensitive values
+// redacted.
+func (l *logger) redactHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		if l.redactHeaders[http.CanonicalHeaderKey(key)] {
+			values = []string{Redacted}
+		}
+		redacted[key] = append([]string(nil), values...)
+	}
+	return redacted
+}
@@ -0,0 +1,35 @@
+package logging
+
+import "net/http"
+
+// Enable modifies provided client so that all requests it sends are logged.
+// Original transport is wrapped and still used for sending requests. If
+// client transport already logs requests, client is not modified.
+func Enable(client *http.Client, config Config) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = NewTransport(next, config)
+}
+
+// NewTransport returns RoundTripper that wraps around provided RoundTripper
+// and logs every request sent through it.
+func NewTransport(next http.RoundTripper, config Config) http.RoundTripper {
+	return &transport{
+		next:   next,
+		logger: newLogger(config),
+	}
+}
+
+type transport struct {
+	next   http.RoundTripper
+	logger *logger
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.logger.do(r, t.next.RoundTrip)
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// SlogLogger returns Logger that writes entries to provided structured logger
+// as attributes. Entries with error are logged with error level, all others
+// with info level. If provided logger is nil, default logger is used.
+func SlogLogger(l *slog.Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, entry Entry) {
+		logger := l
+		if logger == nil {
+			logger = slog.Default()
+		}
+		level := slog.LevelInfo
+		attrs := []slog.Attr{
+			slog.String("method", entry.Method),
+			slog.String("url", entry.URL),
+			slog.Int("status", entry.Status),
+			slog.Duration("duration", entry.Duration),
+			slog.Int64("request_size", entry.RequestSize),
+			slog.Int64("response_size", entry.ResponseSize),
+		}
+		if entry.Attempt > 0 {
+			attrs = append(attrs, slog.Int("attempt", entry.Attempt))
+		}
+		if entry.Err != nil {
+			level = slog.LevelError
+			attrs = append(attrs, slog.String("error", entry.Err.Error()))
+		}
+		if entry.RequestHeader != nil {
+			attrs = append(attrs, headerAttr("request_header", entry.RequestHeader))
+		}
+		if entry.RequestBody != nil {
+			attrs = append(attrs, slog.String("request_body", string(entry.RequestBody)))
+		}
+		if entry.ResponseHeader != nil {
+			attrs = append(attrs, headerAttr("response_header", entry.ResponseHeader))
+		}
+		if entry.ResponseBody != nil {
+			attrs = append(attrs, slog.String("response_body", string(entry.ResponseBody)))
+		}
+		logger.LogAttrs(ctx, level, "http request", attrs...)
+	})
+}
+
+// headerAttr returns group attribute with one attribute per header.
+func headerAttr(key string, header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		if len(values) == 1 {
+			attrs = append(attrs, slog.String(name, values[0]))
+		} else {
+			attrs = append(attrs, slog.Any(name, values))
+		}
+	}
+	return slog.Group(key, attrs...)
+}
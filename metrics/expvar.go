@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ExpvarSink is Sink that publishes metrics via expvar package. Metrics are
+// published as map with "requests", "errors", "in_flight" and "latency"
+// maps, all of them keyed by string representation of labels.
+type ExpvarSink struct {
+	buckets []time.Duration
+
+	requests *expvar.Map
+	errors   *expvar.Map
+	inFlight *expvar.Map
+	latency  *expvar.Map
+	// mu guards creation of histograms in latency map
+	mu sync.Mutex
+}
+
+// NewExpvarSink creates new ExpvarSink and publishes its metrics under
+// provided name. Latency histograms use provided bucket bounds or
+// DefaultBuckets if none are provided. Like expvar.Publish, it panics if
+// name is already in use.
+func NewExpvarSink(name string, buckets ...time.Duration) *ExpvarSink {
+	s := &ExpvarSink{
+		buckets:  sortedBuckets(buckets),
+		requests: new(expvar.Map).Init(),
+		errors:   new(expvar.Map).Init(),
+		inFlight: new(expvar.Map).Init(),
+		latency:  new(expvar.Map).Init(),
+	}
+	root := new(expvar.Map).Init()
+	root.Set("requests", s.requests)
+	root.Set("errors", s.errors)
+	root.Set("in_flight", s.inFlight)
+	root.Set("latency", s.latency)
+	expvar.Publish(name, root)
+	return s
+}
+
+// IncInFlight is implementation of Sink interface.
+func (s *ExpvarSink) IncInFlight(labels Labels) {
+	s.inFlight.Add(labels.String(), 1)
+}
+
+// DecInFlight is implementation of Sink interface.
+func (s *ExpvarSink) DecInFlight(labels Labels) {
+	s.inFlight.Add(labels.String(), -1)
+}
+
+// Observe is implementation of Sink interface.
+func (s *ExpvarSink) Observe(labels Labels, duration time.Duration, err error) {
+	key := labels.String()
+	s.requests.Add(key, 1)
+	if err != nil {
+		s.errors.Add(key, 1)
+	}
+	s.histogram(key).observe(duration)
+}
+
+// histogram returns histogram variable for provided key, creating it if
+// needed.
+func (s *ExpvarSink) histogram(key string) *histogramVar {
+	if v, ok := s.latency.Get(key).(*histogramVar); ok {
+		return v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.latency.Get(key).(*histogramVar); ok {
+		return v
+	}
+	v := &histogramVar{h: newHistogram(s.buckets)}
+	s.latency.Set(key, v)
+	return v
+}
+
+// histogramVar is expvar variable holding latency histogram.
+type histogramVar struct {
+	mu sync.Mutex
+	h  *Histogram
+}
+
+func (v *histogramVar) observe(d time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.h.observe(d)
+}
+
+// String returns JSON representation of histogram with durations in
+// seconds. It is implementation of expvar.Var interface.
+func (v *histogramVar) String() string {
+	v.mu.Lock()
+	h := v.h.copy()
+	v.mu.Unlock()
+	buckets := make([]float64, len(h.Buckets))
+	for i, b := range h.Buckets {
+		buckets[i] = b.Seconds()
+	}
+	data, _ := json.Marshal(struct {
+		Buckets []float64 `json:"buckets"`
+		Counts  []uint64  `json:"counts"`
+		Count   uint64    `json:"count"`
+		Sum     float64   `json:"sum"`
+	}{buckets, h.Counts, h.Count, h.Sum.Seconds()})
+	return string(data)
+}
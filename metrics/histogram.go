@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultBuckets are upper bounds of latency histogram buckets used if sink
+// is created without explicit buckets.
+var DefaultBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram is latency histogram.
+type Histogram struct {
+	// Buckets are sorted upper bounds (inclusive) of buckets.
+	Buckets []time.Duration
+	// Counts are numbers of observations in each bucket. It has one element
+	// more than Buckets, for observations greater than all bounds.
+	Counts []uint64
+	// Count is total number of observations.
+	Count uint64
+	// Sum is sum of all observations.
+	Sum time.Duration
+}
+
+// newHistogram returns empty histogram with provided bucket bounds, or
+// default ones if none are provided.
+func newHistogram(buckets []time.Duration) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{
+		Buckets: buckets,
+		Counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+// sortedBuckets returns sorted copy of provided bucket bounds.
+func sortedBuckets(buckets []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), buckets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// observe records provided duration.
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// copy returns deep copy of histogram.
+func (h *Histogram) copy() Histogram {
+	return Histogram{
+		Buckets: h.Buckets,
+		Counts:  append([]uint64(nil), h.Counts...),
+		Count:   h.Count,
+		Sum:     h.Sum,
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// MemorySink is Sink that keeps metrics in memory. It is useful for tests
+// and for exposing metrics in custom way.
+type MemorySink struct {
+	buckets []time.Duration
+
+	mu       sync.Mutex
+	requests map[Labels]uint64
+	errors   map[Labels]uint64
+	inFlight map[Labels]int64
+	latency  map[Labels]*Histogram
+}
+
+// NewMemorySink creates new MemorySink with provided latency histogram bucket
+// bounds. If none are provided, DefaultBuckets are used.
+func NewMemorySink(buckets ...time.Duration) *MemorySink {
+	return &MemorySink{
+		buckets:  sortedBuckets(buckets),
+		requests: make(map[Labels]uint64),
+		errors:   make(map[Labels]uint64),
+		inFlight: make(map[Labels]int64),
+		latency:  make(map[Labels]*Histogram),
+	}
+}
+
+// IncInFlight is implementation of Sink interface.
+func (s *MemorySink) IncInFlight(labels Labels) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[labels]++
+}
+
+// DecInFlight is implementation of Sink interface.
+func (s *MemorySink) DecInFlight(labels Labels) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[labels]--
+}
+
+// Observe is implementation of Sink interface.
+func (s *MemorySink) Observe(labels Labels, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[labels]++
+	if err != nil {
+		s.errors[labels]++
+	}
+	h, ok := s.latency[labels]
+	if !ok {
+		h = newHistogram(s.buckets)
+		s.latency[labels] = h
+	}
+	h.observe(duration)
+}
+
+// Requests returns number of finished requests with provided labels.
+func (s *MemorySink) Requests(labels Labels) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[labels]
+}
+
+// Errors returns number of failed requests with provided labels.
+func (s *MemorySink) Errors(labels Labels) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors[labels]
+}
+
+// InFlight returns number of requests with provided labels that are
+// currently in flight. Status class of labels has to be empty.
+func (s *MemorySink) InFlight(labels Labels) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight[labels]
+}
+
+// Latency returns copy of latency histogram of requests with provided labels.
+func (s *MemorySink) Latency(labels Labels) Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.latency[labels]
+	if !ok {
+		h = newHistogram(s.buckets)
+	}
+	return h.copy()
+}
+
+// Labels returns labels of all finished requests.
+func (s *MemorySink) Labels() []Labels {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := make([]Labels, 0, len(s.requests))
+	for l := range s.requests {
+		labels = append(labels, l)
+	}
+	return labels
+}
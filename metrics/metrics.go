@@ -0,0 +1,110 @@
+// Package metrics contains middleware and RoundTripper that collect request
+// metrics and report them to pluggable Sink. Sinks that publish metrics via
+// expvar and that keep them in memory are provided.
+//
+// Collected metrics are number of requests, latency histogram, number of
+// requests in flight and number of errors. All of them are labelled by
+// method, host, route and status class. Route is path template (e.g.
+// "/users/:id") captured by url.Param and url.Params middlewares, so that
+// number of distinct labels stays bounded. If parameters were not replaced
+// in path, path itself is used as route.
+//
+// Labels are determined when request is sent, so Middleware has to be placed
+// after url middlewares in chain. RoundTripper returned by NewTransport
+// always sees final request.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+// StatusError is status class of requests that failed without response.
+const StatusError = "error"
+
+// Labels describe request that metrics are collected for.
+type Labels struct {
+	Method string
+	Host   string
+	Route  string
+	// StatusClass is class of response status code ("2xx", "4xx"...),
+	// StatusError if request failed or empty for requests in flight.
+	StatusClass string
+}
+
+// String returns labels joined with spaces.
+func (l Labels) String() string {
+	s := l.Method + " " + l.Host + " " + l.Route
+	if l.StatusClass != "" {
+		s += " " + l.StatusClass
+	}
+	return s
+}
+
+// Sink receives collected metrics. Implementations have to be safe for
+// concurrent use.
+type Sink interface {
+	// IncInFlight is called when request is sent.
+	IncInFlight(labels Labels)
+	// DecInFlight is called with same labels as IncInFlight when response is
+	// received or request fails.
+	DecInFlight(labels Labels)
+	// Observe is called for each finished request with duration it took to
+	// receive response. Error is not nil for failed requests.
+	Observe(labels Labels, duration time.Duration, err error)
+}
+
+// Middleware returns middleware that reports metrics of requests to provided
+// sink.
+func Middleware(sink Sink) c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return do(sink, req, next.Handle)
+		})
+	})
+}
+
+// do sends request using provided function and reports its metrics to sink.
+func do(sink Sink, req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	labels := requestLabels(req)
+	sink.IncInFlight(labels)
+	start := time.Now()
+	resp, err := send(req)
+	duration := time.Since(start)
+	sink.DecInFlight(labels)
+
+	labels.StatusClass = statusClass(resp, err)
+	sink.Observe(labels, duration, err)
+	return resp, err
+}
+
+// requestLabels returns labels for provided request without status class.
+func requestLabels(req *http.Request) Labels {
+	labels := Labels{Method: req.Method}
+	if labels.Method == "" {
+		labels.Method = "GET"
+	}
+	if req.URL != nil {
+		labels.Host = req.URL.Host
+		labels.Route = req.URL.Path
+	}
+	if labels.Host == "" {
+		labels.Host = req.Host
+	}
+	if template := url.Template(req.Context()); template != "" {
+		labels.Route = template
+	}
+	return labels
+}
+
+// statusClass returns status class label for provided result of request.
+func statusClass(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return StatusError
+	}
+	return strconv.Itoa(resp.StatusCode/100) + "xx"
+}
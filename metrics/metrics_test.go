@@ -0,0 +1,154 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/metrics"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+func createHandler(sink *metrics.MemorySink, inFlight metrics.Labels, status int, err error) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if got := sink.InFlight(inFlight); got != 1 {
+			return nil, errors.New("request not in flight")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: status}, nil
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := metrics.NewMemorySink()
+	inFlight := metrics.Labels{Method: "GET", Host: "example.com", Route: "/users/:id"}
+	myErr := errors.New("my error")
+	for _, data := range []struct {
+		Status      int
+		Err         error
+		StatusClass string
+	}{
+		{Status: 200, StatusClass: "2xx"},
+		{Status: 204, StatusClass: "2xx"},
+		{Status: 503, StatusClass: "5xx"},
+		{Err: myErr, StatusClass: metrics.StatusError},
+	} {
+		chain := cliware.NewChain(
+			url.URL("http://example.com/users/:id"),
+			url.Param("id", "42"),
+			metrics.Middleware(sink),
+		)
+		req := cliware.EmptyRequest()
+		_, err := chain.Exec(createHandler(sink, inFlight, data.Status, data.Err)).Handle(req)
+		if err != data.Err {
+			t.Errorf("Wrong error. Got: %v, expected: %v.", err, data.Err)
+		}
+	}
+
+	ok := inFlight
+	ok.StatusClass = "2xx"
+	if got := sink.Requests(ok); got != 2 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 2.", got)
+	}
+	if h := sink.Latency(ok); h.Count != 2 || len(h.Counts) != len(metrics.DefaultBuckets)+1 {
+		t.Errorf("Wrong latency histogram: %+v.", h)
+	}
+	failed := inFlight
+	failed.StatusClass = metrics.StatusError
+	if got := sink.Errors(failed); got != 1 {
+		t.Errorf("Wrong number of errors. Got: %d, expected: 1.", got)
+	}
+	if got := len(sink.Labels()); got != 3 {
+		t.Errorf("Wrong number of label sets. Got: %d, expected: 3.", got)
+	}
+	if got := sink.InFlight(inFlight); got != 0 {
+		t.Errorf("Wrong number of requests in flight. Got: %d, expected: 0.", got)
+	}
+}
+
+// statusRoundTripper returns response with provided status.
+type statusRoundTripper int
+
+func (rt statusRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: int(rt)}, nil
+}
+
+func TestTransport(t *testing.T) {
+	sink := metrics.NewMemorySink()
+	client := &http.Client{Transport: statusRoundTripper(404)}
+	metrics.Enable(client, sink)
+	metrics.Enable(client, sink)
+
+	req, _ := http.NewRequest("POST", "http://example.com/path", nil)
+	client.Do(req)
+	labels := metrics.Labels{Method: "POST", Host: "example.com", Route: "/path", StatusClass: "4xx"}
+	if got := sink.Requests(labels); got != 1 {
+		t.Errorf("Wrong number of requests. Got: %d, expected: 1.", got)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	sink := metrics.NewMemorySink(time.Second, 10*time.Millisecond)
+	labels := metrics.Labels{Method: "GET"}
+	for _, d := range []time.Duration{time.Millisecond, 10 * time.Millisecond, 500 * time.Millisecond, time.Minute} {
+		sink.Observe(labels, d, nil)
+	}
+	h := sink.Latency(labels)
+	expected := []uint64{2, 1, 1}
+	for i := range expected {
+		if h.Counts[i] != expected[i] {
+			t.Errorf("Wrong bucket counts. Got: %v, expected: %v.", h.Counts, expected)
+			break
+		}
+	}
+	if h.Sum != time.Minute+511*time.Millisecond {
+		t.Errorf("Wrong sum. Got: %s, expected: 1m0.511s.", h.Sum)
+	}
+}
+
+// expvarSinks is number of expvar sinks created by tests, used to give each
+// of them unique name, since expvar names can not be reused.
+var expvarSinks int32
+
+func TestExpvarSink(t *testing.T) {
+	name := fmt.Sprintf("metrics_test_%d", atomic.AddInt32(&expvarSinks, 1))
+	sink := metrics.NewExpvarSink(name, time.Second)
+	labels := metrics.Labels{Method: "GET", Host: "example.com", Route: "/", StatusClass: "2xx"}
+	sink.IncInFlight(metrics.Labels{Method: "GET", Host: "example.com", Route: "/"})
+	sink.Observe(labels, 100*time.Millisecond, nil)
+	sink.Observe(labels, 2*time.Second, errors.New("my error"))
+
+	var published struct {
+		Requests map[string]int
+		Errors   map[string]int
+		InFlight map[string]int `json:"in_flight"`
+		Latency  map[string]struct {
+			Buckets []float64
+			Counts  []int
+			Count   int
+			Sum     float64
+		}
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal("Failed to parse published metrics: ", err)
+	}
+	key := "GET example.com / 2xx"
+	if published.Requests[key] != 2 || published.Errors[key] != 1 {
+		t.Errorf("Wrong counters: %+v.", published)
+	}
+	if published.InFlight["GET example.com /"] != 1 {
+		t.Errorf("Wrong in flight gauge: %v.", published.InFlight)
+	}
+	latency := published.Latency[key]
+	if latency.Count != 2 || latency.Sum != 2.1 || len(latency.Counts) != 2 || latency.Counts[1] != 1 {
+		t.Errorf("Wrong latency: %+v.", latency)
+	}
+}
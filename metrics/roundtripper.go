@@ -0,0 +1,36 @@
+package metrics
+
+import "net/http"
+
+// Enable modifies provided client so that metrics of all requests it sends
+// are reported to provided sink. Original transport is wrapped and still used
+// for sending requests. If client transport already reports metrics, client
+// is not modified.
+func Enable(client *http.Client, sink Sink) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = NewTransport(next, sink)
+}
+
+// NewTransport returns RoundTripper that wraps around provided RoundTripper
+// and reports metrics of every request sent through it to provided sink.
+func NewTransport(next http.RoundTripper, sink Sink) http.RoundTripper {
+	return &transport{
+		next: next,
+		sink: sink,
+	}
+}
+
+type transport struct {
+	next http.RoundTripper
+	sink Sink
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return do(t.sink, r, t.next.RoundTrip)
+}
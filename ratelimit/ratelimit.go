@@ -0,0 +1,294 @@
+// Package ratelimit contains client side rate limiting middleware based on
+// token bucket algorithm.
+//
+// Besides configured rate, limiter also follows limits announced by server
+// in response headers (X-RateLimit-Remaining/X-RateLimit-Reset, RateLimit-*
+// headers from IETF draft and Retry-After of 429 responses). When server
+// announces that only few requests remain until limit is reset, requests are
+// spread evenly until reset, so client slows down before server starts
+// rejecting requests.
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/delicb/cliware"
+)
+
+// Config holds configuration of rate limiter.
+type Config struct {
+	// Rate is number of requests per second allowed for each key. If rate is
+	// not positive, requests are limited only by server announced limits.
+	Rate float64
+	// Burst is number of requests that can be sent at once, before rate
+	// limiting kicks in. Default is 1.
+	Burst int
+	// KeyFunc returns key for request. Requests with same key share limit.
+	// Default is request host.
+	KeyFunc func(*http.Request) string
+	// IgnoreHeaders disables adapting to limits announced by server.
+	IgnoreHeaders bool
+}
+
+// Limiter limits rate of requests per key. It is safe for concurrent use.
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// New creates new Limiter with provided configuration.
+func New(config Config) *Limiter {
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = hostKey
+	}
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// hostKey is key function that returns host of request.
+func hostKey(req *http.Request) string {
+	if req.URL != nil && req.URL.Host != "" {
+		return req.URL.Host
+	}
+	return req.Host
+}
+
+// Middleware returns middleware that delays requests until limiter allows
+// them to be sent. If request context is done while waiting, context error is
+// returned and request is not sent.
+func (l *Limiter) Middleware() c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			key := l.config.KeyFunc(req)
+			if err := l.wait(req, key); err != nil {
+				return nil, err
+			}
+			resp, err := next.Handle(req)
+			if resp != nil && !l.config.IgnoreHeaders {
+				l.update(key, resp)
+			}
+			return resp, err
+		})
+	})
+}
+
+// wait blocks until request with provided key can be sent or request context
+// is done.
+func (l *Limiter) wait(req *http.Request, key string) error {
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.config.Burst), last: l.now(), remaining: -1}
+		l.buckets[key] = b
+	}
+	wait, r := b.reserve(l.now(), l.config.Rate, l.config.Burst)
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		// request is not sent, so it must not delay requests that are sent
+		// after it
+		l.mu.Lock()
+		b.cancel(r, l.config.Burst)
+		l.mu.Unlock()
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// update adapts limits for provided key to limits announced in response.
+func (l *Limiter) update(key string, resp *http.Response) {
+	now := l.now()
+	remaining, reset, ok := parseHeaders(resp, now)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.remaining = remaining
+		b.reset = reset
+		b.next = now
+		b.updates++
+	}
+}
+
+// bucket holds state of limit for single key.
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	// limits announced by server, remaining is -1 if unknown
+	remaining int
+	reset     time.Time
+	next      time.Time
+	// updates is number of times server limits were updated
+	updates uint64
+}
+
+// reservation is what was taken from bucket for single request, so it can be
+// returned if request is not sent.
+type reservation struct {
+	token bool
+	// remaining is number of remaining requests before reservation, -1 if
+	// request did not use server limit
+	remaining int
+	next      time.Time
+	reserved  time.Time
+	updates   uint64
+}
+
+// reserve takes token from bucket and returns time caller has to wait before
+// sending request and reservation that can be cancelled.
+func (b *bucket) reserve(now time.Time, rate float64, burst int) (time.Duration, reservation) {
+	r := reservation{remaining: -1, updates: b.updates}
+	sendAt := now
+	if rate > 0 {
+		r.token = true
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+		b.last = now
+		b.tokens--
+		if b.tokens < 0 {
+			sendAt = now.Add(time.Duration(-b.tokens / rate * float64(time.Second)))
+		}
+	}
+
+	if b.remaining >= 0 {
+		if !sendAt.Before(b.reset) {
+			// server limit was reset, new one is not known yet
+			b.remaining = -1
+		} else if b.remaining == 0 {
+			r.remaining = 0
+			sendAt = b.reset
+			b.remaining = -1
+		} else {
+			r.remaining, r.next = b.remaining, b.next
+			// spread remaining requests evenly until reset
+			if sendAt.Before(b.next) {
+				sendAt = b.next
+			}
+			b.next = sendAt.Add(b.reset.Sub(sendAt) / time.Duration(b.remaining))
+			b.remaining--
+			r.reserved = b.next
+		}
+	}
+	return sendAt.Sub(now), r
+}
+
+// cancel returns to bucket what was taken by provided reservation. Server
+// limits are restored only if they were not updated in the meantime.
+func (b *bucket) cancel(r reservation, burst int) {
+	if r.token {
+		b.tokens++
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	if r.remaining < 0 || b.updates != r.updates {
+		return
+	}
+	if r.remaining == 0 {
+		if b.remaining < 0 {
+			b.remaining = 0
+		}
+		return
+	}
+	b.remaining++
+	// slot can be given back only if no request reserved later slot
+	if b.next.Equal(r.reserved) {
+		b.next = r.next
+	}
+}
+
+// parseHeaders reads limits announced by server in response headers. It
+// returns number of remaining requests, time when limit is reset and whether
+// limits were found.
+func parseHeaders(resp *http.Response, now time.Time) (int, time.Time, bool) {
+	h := resp.Header
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(h.Get("Retry-After"))); err == nil {
+			return 0, now.Add(time.Duration(seconds) * time.Second), true
+		}
+		if date, err := http.ParseTime(h.Get("Retry-After")); err == nil {
+			return 0, date, true
+		}
+	}
+
+	// single RateLimit header from newer versions of IETF draft, either as
+	// "limit=10, remaining=5, reset=30" or as "default";r=5;t=30
+	if value := h.Get("RateLimit"); value != "" {
+		params := parseParams(value)
+		remaining, err1 := strconv.Atoi(firstParam(params, "remaining", "r"))
+		reset, err2 := strconv.Atoi(firstParam(params, "reset", "t"))
+		if err1 == nil && err2 == nil {
+			return remaining, now.Add(time.Duration(reset) * time.Second), true
+		}
+	}
+
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		remaining, err := strconv.Atoi(strings.TrimSpace(h.Get(prefix + "Remaining")))
+		if err != nil {
+			continue
+		}
+		reset, err := strconv.ParseInt(strings.TrimSpace(h.Get(prefix+"Reset")), 10, 64)
+		if err != nil {
+			continue
+		}
+		return remaining, resetTime(reset, now), true
+	}
+	return 0, time.Time{}, false
+}
+
+// resetTime converts value of reset header to time. Some servers send number
+// of seconds until reset and others send Unix timestamp of reset, values that
+// are too large to be number of seconds are considered timestamps.
+func resetTime(value int64, now time.Time) time.Time {
+	if value > 1000000000 {
+		return time.Unix(value, 0)
+	}
+	return now.Add(time.Duration(value) * time.Second)
+}
+
+// parseParams parses key=value pairs separated by commas or semicolons.
+func parseParams(value string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `" `)
+		}
+	}
+	return params
+}
+
+// firstParam returns value of first of provided keys that exists in params.
+func firstParam(params map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := params[key]; ok {
+			return value
+		}
+	}
+	return ""
+}
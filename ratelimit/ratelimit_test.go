@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+var testNow = time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func TestBucketReserve(t *testing.T) {
+	b := &bucket{tokens: 2, last: testNow, remaining: -1}
+	for _, expected := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got, _ := b.reserve(testNow, 2, 2); got != expected {
+			t.Errorf("Wrong wait. Got: %s, expected: %s.", got, expected)
+		}
+	}
+	// tokens are refilled over time
+	if got, _ := b.reserve(testNow.Add(2*time.Second), 2, 2); got != 0 {
+		t.Errorf("Wrong wait after refill. Got: %s, expected: 0.", got)
+	}
+}
+
+func TestBucketReserveServerLimits(t *testing.T) {
+	b := &bucket{remaining: 4, reset: testNow.Add(4 * time.Second), next: testNow}
+	// remaining requests are spread evenly until reset
+	for _, expected := range []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second} {
+		if got, _ := b.reserve(testNow, 0, 1); got != expected {
+			t.Errorf("Wrong wait. Got: %s, expected: %s.", got, expected)
+		}
+	}
+
+	b = &bucket{remaining: 0, reset: testNow.Add(10 * time.Second), next: testNow}
+	if got, _ := b.reserve(testNow, 0, 1); got != 10*time.Second {
+		t.Errorf("Wrong wait for exhausted limit. Got: %s, expected: %s.", got, 10*time.Second)
+	}
+	// after reset, limit is not known any more
+	if got, _ := b.reserve(testNow, 0, 1); got != 0 {
+		t.Errorf("Wrong wait after reset. Got: %s, expected: 0.", got)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	for _, data := range []struct {
+		Status    int
+		Header    http.Header
+		Remaining int
+		Reset     time.Time
+		OK        bool
+	}{
+		{Status: 200, Header: http.Header{}, OK: false},
+		{
+			Status:    200,
+			Header:    http.Header{"X-Ratelimit-Remaining": {"10"}, "X-Ratelimit-Reset": {"30"}},
+			Remaining: 10, Reset: testNow.Add(30 * time.Second), OK: true,
+		},
+		{
+			Status:    200,
+			Header:    http.Header{"X-Ratelimit-Remaining": {"10"}, "X-Ratelimit-Reset": {strconv.FormatInt(testNow.Add(time.Minute).Unix(), 10)}},
+			Remaining: 10, Reset: testNow.Add(time.Minute), OK: true,
+		},
+		{
+			Status:    200,
+			Header:    http.Header{"Ratelimit-Remaining": {"5"}, "Ratelimit-Reset": {"7"}},
+			Remaining: 5, Reset: testNow.Add(7 * time.Second), OK: true,
+		},
+		{
+			Status:    200,
+			Header:    http.Header{"Ratelimit": {"limit=100, remaining=50, reset=5"}},
+			Remaining: 50, Reset: testNow.Add(5 * time.Second), OK: true,
+		},
+		{
+			Status:    200,
+			Header:    http.Header{"Ratelimit": {`"default";r=3;t=9`}},
+			Remaining: 3, Reset: testNow.Add(9 * time.Second), OK: true,
+		},
+		{
+			Status:    429,
+			Header:    http.Header{"Retry-After": {"20"}},
+			Remaining: 0, Reset: testNow.Add(20 * time.Second), OK: true,
+		},
+	} {
+		remaining, reset, ok := parseHeaders(&http.Response{StatusCode: data.Status, Header: data.Header}, testNow)
+		if ok != data.OK || remaining != data.Remaining || !reset.Equal(data.Reset) {
+			t.Errorf("Wrong limits for %v. Got: (%d, %s, %t), expected: (%d, %s, %t).",
+				data.Header, remaining, reset, ok, data.Remaining, data.Reset, data.OK)
+		}
+	}
+}
+
+func TestBucketCancel(t *testing.T) {
+	b := &bucket{tokens: 1, last: testNow, remaining: 4, reset: testNow.Add(4 * time.Second), next: testNow}
+	b.reserve(testNow, 1, 1)
+	// cancelled request gives back both token and slot announced by server
+	_, r := b.reserve(testNow, 1, 1)
+	b.cancel(r, 1)
+	if got, _ := b.reserve(testNow, 1, 1); got != time.Second {
+		t.Errorf("Wrong wait after cancel. Got: %s, expected: %s.", got, time.Second)
+	}
+	if b.remaining != 2 {
+		t.Errorf("Wrong number of remaining requests. Got: %d, expected: 2.", b.remaining)
+	}
+
+	// exhausted server limit is still in force after cancel
+	b = &bucket{remaining: 0, reset: testNow.Add(10 * time.Second), next: testNow}
+	_, r = b.reserve(testNow, 0, 1)
+	b.cancel(r, 1)
+	if got, _ := b.reserve(testNow, 0, 1); got != 10*time.Second {
+		t.Errorf("Wrong wait after cancel. Got: %s, expected: %s.", got, 10*time.Second)
+	}
+}
+
+func createHandler(header http.Header) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Header: header, Request: req}, nil
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := New(Config{Rate: 1, Burst: 1})
+	handler := limiter.Middleware().Exec(createHandler(http.Header{}))
+
+	req := cliware.EmptyRequest()
+	req.URL.Host = "example.com"
+	if _, err := handler.Handle(req); err != nil {
+		t.Fatal("Handle returned error:", err)
+	}
+
+	// second request has to wait for a second, which is longer than timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := handler.Handle(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+	// cancelled request did not take token, so next one waits for one second
+	// at most
+	limiter.mu.Lock()
+	wait, _ := limiter.buckets["example.com"].reserve(limiter.now(), 1, 1)
+	limiter.mu.Unlock()
+	if wait > time.Second {
+		t.Errorf("Cancelled request delays next one. Got wait: %s, expected at most: %s.", wait, time.Second)
+	}
+
+	// other hosts have their own limit
+	other := cliware.EmptyRequest()
+	other.URL.Host = "example.org"
+	if _, err := handler.Handle(other); err != nil {
+		t.Error("Handle returned error:", err)
+	}
+}
+
+func TestMiddlewareServerLimits(t *testing.T) {
+	limiter := New(Config{})
+	header := http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"60"}}
+	handler := limiter.Middleware().Exec(createHandler(header))
+
+	req := cliware.EmptyRequest()
+	if _, err := handler.Handle(req); err != nil {
+		t.Fatal("Handle returned error:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := handler.Handle(req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+
+	limiter = New(Config{IgnoreHeaders: true})
+	handler = limiter.Middleware().Exec(createHandler(header))
+	for i := 0; i < 2; i++ {
+		if _, err := handler.Handle(cliware.EmptyRequest()); err != nil {
+			t.Error("Server limits not ignored:", err)
+		}
+	}
+}
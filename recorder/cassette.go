@@ -0,0 +1,117 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Cassette holds recorded interactions. It is stored as JSON file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is single recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	// used indicates if interaction was already replayed
+	used bool
+}
+
+// Request is recorded request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is recorded response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is recorded request or response body. It is stored as string if it
+// is valid UTF-8, otherwise it is stored base64 encoded.
+type Body []byte
+
+// body is JSON representation of Body that is not valid UTF-8.
+type body struct {
+	Base64 string `json:"base64"`
+}
+
+// MarshalJSON is implementation of json.Marshaler interface.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(body{Base64: base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON is implementation of json.Unmarshaler interface.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var encoded body
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// LoadCassette reads cassette from file with provided path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, err
+	}
+	return cassette, nil
+}
+
+// Save writes cassette to file with provided path. Missing directories are
+// created.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// write to temporary file first, so cassette is never partially written
+	f, err := ioutil.TempFile(dir, "cassette-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package recorder
+
+import "bytes"
+
+// Matcher determines if request that is being sent matches recorded request.
+// Request that is being sent is redacted before matching, same way recorded
+// requests are.
+type Matcher func(req, recorded *Request) bool
+
+// MatchMethod matches requests with same method.
+func MatchMethod(req, recorded *Request) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with same URL.
+func MatchURL(req, recorded *Request) bool {
+	return req.URL == recorded.URL
+}
+
+// MatchBody matches requests with same body.
+func MatchBody(req, recorded *Request) bool {
+	return bytes.Equal(req.Body, recorded.Body)
+}
+
+// MatchHeaders returns matcher that matches requests with same values of
+// provided headers.
+func MatchHeaders(headers ...string) Matcher {
+	return func(req, recorded *Request) bool {
+		for _, h := range headers {
+			if !stringsEqual(req.Header.Values(h), recorded.Header.Values(h)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchAll returns matcher that matches requests matched by all provided
+// matchers.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(req, recorded *Request) bool {
+		for _, m := range matchers {
+			if !m(req, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
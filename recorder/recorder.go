@@ -0,0 +1,278 @@
+// Package recorder contains RoundTripper that records HTTP interactions to
+// cassette files and replays them later, so tests that use real middleware
+// chains can run offline and deterministically.
+//
+// Recorder works in one of three modes. In ModeRecord requests are sent
+// using underlying RoundTripper and interactions are stored to cassette
+// when Stop is called. In ModeReplay requests are never sent, responses are
+// taken from cassette instead. In ModePassthrough recorder does nothing and
+// requests are just sent using underlying RoundTripper.
+//
+// Cassettes are JSON files. Before interactions are stored, credentials are
+// redacted from them: values of Authorization, Proxy-Authorization, Cookie
+// and Set-Cookie headers, configured headers and query parameters and
+// anything custom redaction function removes.
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Mode is mode in which recorder works.
+type Mode int
+
+// Modes of recorder.
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+	ModePassthrough
+)
+
+// Redacted is value that replaces redacted data.
+const Redacted = "REDACTED"
+
+// ErrInteractionNotFound is returned in replay mode for requests that do not
+// match any recorded interaction.
+var ErrInteractionNotFound = errors.New("recorder: interaction not found")
+
+var (
+	defaultMatcher       = MatchAll(MatchMethod, MatchURL)
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+)
+
+// Config holds configuration of recorder.
+type Config struct {
+	// Path is path of cassette file.
+	Path string
+	// Mode is mode of recorder. Default is ModeReplay.
+	Mode Mode
+	// Transport is used for sending requests in record and passthrough
+	// mode. Default is http.DefaultTransport.
+	Transport http.RoundTripper
+	// Matcher determines which recorded interaction is replayed for request.
+	// Default matches method and URL.
+	Matcher Matcher
+	// RedactHeaders are additional headers whose values are redacted.
+	RedactHeaders []string
+	// RedactQuery are query parameters whose values are redacted.
+	RedactQuery []string
+	// Redact is called for each interaction after built in redaction and it
+	// can remove other secrets (e.g. from bodies). When request is replayed,
+	// only its Request part is set.
+	Redact func(*Interaction)
+}
+
+// Recorder is RoundTripper that records and replays interactions. It is safe
+// for concurrent use.
+type Recorder struct {
+	config Config
+
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// New creates new Recorder with provided configuration. In replay mode
+// cassette is loaded from configured path.
+func New(config Config) (*Recorder, error) {
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+	if config.Matcher == nil {
+		config.Matcher = defaultMatcher
+	}
+	config.RedactHeaders = append(append([]string(nil), defaultRedactHeaders...), config.RedactHeaders...)
+	r := &Recorder{
+		config:   config,
+		cassette: &Cassette{},
+	}
+	if config.Mode == ModeReplay {
+		cassette, err := LoadCassette(config.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+	}
+	return r, nil
+}
+
+// Stop stores recorded interactions to cassette in record mode. In other
+// modes it does nothing.
+func (r *Recorder) Stop() error {
+	if r.config.Mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.config.Path)
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch r.config.Mode {
+	case ModePassthrough:
+		return r.config.Transport.RoundTrip(req)
+	case ModeRecord:
+		return r.record(req)
+	default:
+		return r.replay(req)
+	}
+}
+
+// record sends request and records interaction.
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	recorded, err := r.recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	// body was consumed, so copy of request is sent
+	sent := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		sent.Body = ioutil.NopCloser(bytes.NewReader(recorded.Body))
+	}
+	resp, err := r.config.Transport.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: *recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactHeader(resp.Header),
+			Body:       respBody,
+		},
+	}
+	if r.config.Redact != nil {
+		r.config.Redact(interaction)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay returns response from recorded interaction that matches request.
+// Interactions that were not replayed yet are preferred, so repeated
+// requests get responses in order they were recorded. Once all matching
+// interactions are replayed, last one is used for further requests.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	recorded, err := r.recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.config.Redact != nil {
+		interaction := &Interaction{Request: *recorded}
+		r.config.Redact(interaction)
+		recorded = &interaction.Request
+	}
+
+	r.mu.Lock()
+	var found *Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.config.Matcher(recorded, &i.Request) {
+			continue
+		}
+		found = i
+		if !i.used {
+			break
+		}
+	}
+	if found != nil {
+		found.used = true
+	}
+	r.mu.Unlock()
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, recorded.Method, recorded.URL)
+	}
+
+	resp := &http.Response{
+		Status:        strconv.Itoa(found.Response.StatusCode) + " " + http.StatusText(found.Response.StatusCode),
+		StatusCode:    found.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        found.Response.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(found.Response.Body)),
+		ContentLength: int64(len(found.Response.Body)),
+		Request:       req,
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	return resp, nil
+}
+
+// recordRequest returns redacted representation of provided request. Request
+// body is read, so it has to be replaced before request is sent.
+func (r *Recorder) recordRequest(req *http.Request) (*Request, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = readBody(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	return &Request{
+		Method: method,
+		URL:    r.redactURL(req.URL),
+		Header: r.redactHeader(req.Header),
+		Body:   body,
+	}, nil
+}
+
+// readBody reads and closes provided body.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	data, err := ioutil.ReadAll(body)
+	body.Close()
+	return data, err
+}
+
+// redactURL returns string representation of provided URL with password and
+// configured query parameters redacted.
+func (r *Recorder) redactURL(u *url.URL) string {
+	redacted := *u
+	if _, ok := u.User.Password(); ok {
+		redacted.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	if len(r.config.RedactQuery) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for _, key := range r.config.RedactQuery {
+			if values, ok := query[key]; ok {
+				for i := range values {
+					values[i] = Redacted
+				}
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// redactHeader returns copy of provided header with sensitive values
+// redacted.
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range r.config.RedactHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(key)]; ok {
+			redacted[http.CanonicalHeaderKey(key)] = []string{Redacted}
+		}
+	}
+	return redacted
+}
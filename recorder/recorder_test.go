@@ -0,0 +1,201 @@
+package recorder_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/auth"
+	"github.com/delicb/cliware-middlewares/body"
+	"github.com/delicb/cliware-middlewares/recorder"
+	"github.com/delicb/cliware-middlewares/url"
+)
+
+// newServer returns server that responds with number of request and request
+// body, and counter of requests it received.
+func newServer() (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		data, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%d %s", n, data)
+	}))
+	return server, &count
+}
+
+// send sends request using provided transport through middleware chain
+// similar to one used in production.
+func send(t *testing.T, transport http.RoundTripper, baseURL, data string) string {
+	client := &http.Client{Transport: transport}
+	chain := cliware.NewChain(
+		url.URL(baseURL+"/items?token=secret&page=1"),
+		auth.Bearer("secret"),
+		body.String(data),
+	)
+	resp, err := chain.Exec(cliware.HandlerFunc(client.Do)).Handle(cliware.EmptyRequest())
+	if err != nil {
+		t.Fatal("Got error sending request: ", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Wrong status. Got: %d, expected: %d.", resp.StatusCode, http.StatusCreated)
+	}
+	return string(respBody)
+}
+
+func TestRecordReplay(t *testing.T) {
+	server, count := newServer()
+	path := filepath.Join(t.TempDir(), "cassettes", "test.json")
+	config := recorder.Config{
+		Path:        path,
+		Mode:        recorder.ModeRecord,
+		Matcher:     recorder.MatchAll(recorder.MatchMethod, recorder.MatchURL, recorder.MatchBody),
+		RedactQuery: []string{"token"},
+	}
+	rec, err := recorder.New(config)
+	if err != nil {
+		t.Fatal("Failed to create recorder: ", err)
+	}
+	for _, data := range []string{"a", "b", "a"} {
+		send(t, rec, server.URL, data)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatal("Failed to save cassette: ", err)
+	}
+	server.Close()
+
+	saved, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(saved), "secret") {
+		t.Errorf("Secrets not redacted from cassette: %s", saved)
+	}
+
+	// server is closed, so responses have to come from cassette
+	config.Mode = recorder.ModeReplay
+	rec, err = recorder.New(config)
+	if err != nil {
+		t.Fatal("Failed to create recorder: ", err)
+	}
+	for _, data := range []struct {
+		Body     string
+		Expected string
+	}{
+		{Body: "a", Expected: "1 a"},
+		{Body: "a", Expected: "3 a"},
+		{Body: "a", Expected: "3 a"},
+		{Body: "b", Expected: "2 b"},
+	} {
+		if got := send(t, rec, server.URL, data.Body); got != data.Expected {
+			t.Errorf("Wrong replayed body. Got: %s, expected: %s.", got, data.Expected)
+		}
+	}
+	if *count != 3 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 3.", *count)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/other", nil)
+	_, err = rec.RoundTrip(req)
+	if !errors.Is(err, recorder.ErrInteractionNotFound) {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, recorder.ErrInteractionNotFound)
+	}
+}
+
+func TestMatchHeaders(t *testing.T) {
+	matcher := recorder.MatchHeaders("Accept")
+	for _, data := range []struct {
+		Req      http.Header
+		Recorded http.Header
+		Matches  bool
+	}{
+		{Req: http.Header{"Accept": {"text/plain"}}, Recorded: http.Header{"Accept": {"text/plain"}}, Matches: true},
+		{Req: http.Header{"Accept": {"text/plain"}}, Recorded: http.Header{"Accept": {"text/html"}}, Matches: false},
+		{Req: http.Header{}, Recorded: http.Header{"Accept": {"text/plain"}}, Matches: false},
+		{Req: http.Header{"Other": {"1"}}, Recorded: http.Header{"Other": {"2"}}, Matches: true},
+	} {
+		got := matcher(&recorder.Request{Header: data.Req}, &recorder.Request{Header: data.Recorded})
+		if got != data.Matches {
+			t.Errorf("Wrong match for %v and %v. Got: %t, expected: %t.", data.Req, data.Recorded, got, data.Matches)
+		}
+	}
+}
+
+func TestCustomRedact(t *testing.T) {
+	server, _ := newServer()
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "test.json")
+	rec, _ := recorder.New(recorder.Config{
+		Path: path,
+		Mode: recorder.ModeRecord,
+		Redact: func(i *recorder.Interaction) {
+			i.Request.Body = recorder.Body(strings.Replace(string(i.Request.Body), "password", recorder.Redacted, -1))
+			i.Response.Body = recorder.Body(strings.Replace(string(i.Response.Body), "password", recorder.Redacted, -1))
+		},
+	})
+	if got := send(t, rec, server.URL, "password"); got != "1 password" {
+		t.Errorf("Redaction modified response. Got: %s, expected: 1 password.", got)
+	}
+	rec.Stop()
+	cassette, err := recorder.LoadCassette(path)
+	if err != nil {
+		t.Fatal("Failed to load cassette: ", err)
+	}
+	i := cassette.Interactions[0]
+	if string(i.Request.Body) != recorder.Redacted || string(i.Response.Body) != "1 "+recorder.Redacted {
+		t.Errorf("Bodies not redacted: %q, %q.", i.Request.Body, i.Response.Body)
+	}
+	if i.Request.Header.Get("Authorization") != recorder.Redacted || i.Response.Header.Get("Set-Cookie") != recorder.Redacted {
+		t.Errorf("Headers not redacted: %v, %v.", i.Request.Header, i.Response.Header)
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	server, count := newServer()
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "test.json")
+	rec, err := recorder.New(recorder.Config{Path: path, Mode: recorder.ModePassthrough})
+	if err != nil {
+		t.Fatal("Failed to create recorder: ", err)
+	}
+	send(t, rec, server.URL, "a")
+	rec.Stop()
+	if *count != 1 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 1.", *count)
+	}
+	if _, err := recorder.LoadCassette(path); err == nil {
+		t.Error("Cassette saved in passthrough mode.")
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := recorder.New(recorder.Config{Path: filepath.Join(t.TempDir(), "missing.json")})
+	if err == nil {
+		t.Error("Expected error for missing cassette.")
+	}
+}
+
+func TestBinaryBody(t *testing.T) {
+	cassette := &recorder.Cassette{Interactions: []*recorder.Interaction{{
+		Request:  recorder.Request{Method: "GET", URL: "http://example.com/"},
+		Response: recorder.Response{StatusCode: 200, Body: recorder.Body{0xff, 0x00, 0xfe}},
+	}}}
+	path := filepath.Join(t.TempDir(), "test.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal("Failed to save cassette: ", err)
+	}
+	loaded, err := recorder.LoadCassette(path)
+	if err != nil {
+		t.Fatal("Failed to load cassette: ", err)
+	}
+	if got := loaded.Interactions[0].Response.Body; string(got) != "\xff\x00\xfe" {
+		t.Errorf("Wrong binary body. Got: %q, expected: %q.", got, "\xff\x00\xfe")
+	}
+}
@@ -3,6 +3,7 @@ package retry
 import (
 	"math"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -52,9 +53,89 @@ func ExponentialJitterBackoff(min, max time.Duration, factor float64) BackoffStr
 	})
 }
 
+// FullJitterBackoff returns BackoffStrategy that picks random duration between
+// zero and exponentially increasing time (doubled each attempt, starting from
+// base, capped at max). Random numbers are drawn from provided source, or from
+// new source seeded with current time if source is nil.
+func FullJitterBackoff(base, max time.Duration, source rand.Source) BackoffStrategy {
+	rnd := newLockedRand(source)
+	return BackoffStrategy(func(n int) time.Duration {
+		return rnd.between(0, calcExponential(base, max, 2, n))
+	})
+}
+
+// EqualJitterBackoff returns BackoffStrategy that keeps half of exponentially
+// increasing time (doubled each attempt, starting from base, capped at max) and
+// picks random duration up to other half. Random numbers are drawn from
+// provided source, or from new source seeded with current time if source is nil.
+func EqualJitterBackoff(base, max time.Duration, source rand.Source) BackoffStrategy {
+	rnd := newLockedRand(source)
+	return BackoffStrategy(func(n int) time.Duration {
+		half := calcExponential(base, max, 2, n) / 2
+		return half + rnd.between(0, half)
+	})
+}
+
+// DecorrelatedJitterBackoff returns BackoffStrategy where each delay is random
+// duration between base and three times previous delay, capped at max. Since
+// strategy is shared between requests, previous delays are not remembered,
+// but drawn again for every attempt, which keeps strategy safe for concurrent
+// use. Random numbers are drawn from provided source, or from new source
+// seeded with current time if source is nil.
+func DecorrelatedJitterBackoff(base, max time.Duration, source rand.Source) BackoffStrategy {
+	rnd := newLockedRand(source)
+	return BackoffStrategy(func(n int) time.Duration {
+		rnd.Lock()
+		defer rnd.Unlock()
+		d := base
+		for i := 0; i < n; i++ {
+			upper := max
+			if d < max/3 {
+				upper = 3 * d
+			}
+			d = minDuration(base+rnd.duration(upper-base), max)
+		}
+		return d
+	})
+}
+
+// lockedRand is random number generator safe for concurrent use.
+type lockedRand struct {
+	sync.Mutex
+	rnd *rand.Rand
+}
+
+func newLockedRand(source rand.Source) *lockedRand {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	return &lockedRand{rnd: rand.New(source)}
+}
+
+// between returns random duration in [min, max] interval.
+func (r *lockedRand) between(min, max time.Duration) time.Duration {
+	r.Lock()
+	defer r.Unlock()
+	return min + r.duration(max-min)
+}
+
+// duration returns random duration in [0, d] interval. Caller has to hold lock.
+func (r *lockedRand) duration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if d == math.MaxInt64 {
+		return time.Duration(r.rnd.Int63())
+	}
+	return time.Duration(r.rnd.Int63n(int64(d) + 1))
+}
+
 func calcExponential(min, max time.Duration, factor float64, attempt int) time.Duration {
-	d := time.Duration(float64(min) * math.Pow(factor, float64(attempt)))
-	return minDuration(d, max)
+	d := float64(min) * math.Pow(factor, float64(attempt))
+	if d >= float64(max) {
+		return max
+	}
+	return time.Duration(d)
 }
 
 func calcLinear(step time.Duration, attempt int) time.Duration {
@@ -1,6 +1,7 @@
 package retry_test
 
 import (
+	"math/rand"
 	"testing"
 	"time"
 
@@ -152,3 +153,53 @@ func TestExponentialJitterBackoff(t *testing.T) {
 		}
 	}
 }
+
+func TestJitterBackoffBounds(t *testing.T) {
+	base, max := 100*time.Millisecond, 10*time.Second
+	for _, data := range []struct {
+		Name     string
+		Backoff  retry.BackoffStrategy
+		Attempt  int
+		Min, Max time.Duration
+	}{
+		{"full", retry.FullJitterBackoff(base, max, nil), 1, 0, 200 * time.Millisecond},
+		{"full", retry.FullJitterBackoff(base, max, nil), 3, 0, 800 * time.Millisecond},
+		{"full", retry.FullJitterBackoff(base, max, nil), 100, 0, max},
+		{"equal", retry.EqualJitterBackoff(base, max, nil), 1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"equal", retry.EqualJitterBackoff(base, max, nil), 3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{"equal", retry.EqualJitterBackoff(base, max, nil), 100, max / 2, max},
+		{"decorrelated", retry.DecorrelatedJitterBackoff(base, max, nil), 1, base, 300 * time.Millisecond},
+		{"decorrelated", retry.DecorrelatedJitterBackoff(base, max, nil), 3, base, 2700 * time.Millisecond},
+		{"decorrelated", retry.DecorrelatedJitterBackoff(base, max, nil), 100, base, max},
+	} {
+		for i := 0; i < 100; i++ {
+			got := data.Backoff(data.Attempt)
+			if got < data.Min || got > data.Max {
+				t.Errorf("Got wrong %s jitter backoff. Got: %s, expected result between %s and %s.",
+					data.Name, got, data.Min, data.Max)
+			}
+		}
+	}
+}
+
+func TestJitterBackoffSeeded(t *testing.T) {
+	for _, create := range []func(source rand.Source) retry.BackoffStrategy{
+		func(source rand.Source) retry.BackoffStrategy {
+			return retry.FullJitterBackoff(time.Second, time.Minute, source)
+		},
+		func(source rand.Source) retry.BackoffStrategy {
+			return retry.EqualJitterBackoff(time.Second, time.Minute, source)
+		},
+		func(source rand.Source) retry.BackoffStrategy {
+			return retry.DecorrelatedJitterBackoff(time.Second, time.Minute, source)
+		},
+	} {
+		first := create(rand.NewSource(42))
+		second := create(rand.NewSource(42))
+		for n := 1; n < 10; n++ {
+			if got, expected := first(n), second(n); got != expected {
+				t.Errorf("Backoffs with same seed differ. Got: %s, expected: %s.", got, expected)
+			}
+		}
+	}
+}
@@ -2,9 +2,13 @@ package retry
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"runtime"
+	"sync"
 )
 
 // BodyStrategy defines what to do with request body in event when request
@@ -31,3 +35,195 @@ func CacheBodyStrategy(r *http.Request) (func() io.ReadCloser, error) {
 		return ioutil.NopCloser(bytes.NewBuffer(buf))
 	}, nil
 }
+
+// ErrBodyNotReplayable is returned when request has to be retried, but its
+// body can not be sent again.
+var ErrBodyNotReplayable = errors.New("retry: request body can not be replayed")
+
+// NotReplayableError is returned instead of error of last attempt when request
+// should have been retried, but its body could not be replayed.
+type NotReplayableError struct {
+	// Err is error returned by last attempt.
+	Err error
+}
+
+// Error is implementation of error interface for NotReplayableError.
+func (e *NotReplayableError) Error() string {
+	return ErrBodyNotReplayable.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns error returned by last attempt.
+func (e *NotReplayableError) Unwrap() error {
+	return e.Err
+}
+
+// GetBodyStrategy uses request GetBody function to obtain body for every
+// attempt, so body is never buffered by retry logic. Middlewares from body
+// package set GetBody, as does http.NewRequest for in-memory bodies. If
+// GetBody is not set, it falls back to CacheBodyStrategy.
+func GetBodyStrategy(r *http.Request) (func() io.ReadCloser, error) {
+	if r.GetBody == nil {
+		return CacheBodyStrategy(r)
+	}
+	first := r.Body
+	return func() io.ReadCloser {
+		// original body can be used for first attempt
+		if first != nil {
+			body := first
+			first = nil
+			return body
+		}
+		body, err := r.GetBody()
+		if err != nil {
+			return errorBody{err: err}
+		}
+		return body
+	}, nil
+}
+
+// FileBodyStrategy returns BodyStrategy that caches body in memory if it is
+// not larger than provided threshold and writes it to temporary file
+// otherwise. Temporary file is closed and removed once retry RoundTripper
+// finishes with request and all bodies read from it are closed. If strategy
+// is used outside of retry RoundTripper, file is closed once it is collected
+// by garbage collector.
+func FileBodyStrategy(threshold int64) BodyStrategy {
+	return BodyStrategy(func(r *http.Request) (func() io.ReadCloser, error) {
+		if r.Body == nil {
+			return CacheBodyStrategy(r)
+		}
+		buf, err := ioutil.ReadAll(io.LimitReader(r.Body, threshold+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buf)) <= threshold {
+			r.Body.Close()
+			return func() io.ReadCloser {
+				return ioutil.NopCloser(bytes.NewReader(buf))
+			}, nil
+		}
+
+		spill, err := newSpillFile(io.MultiReader(bytes.NewReader(buf), r.Body))
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !onRetryDone(r.Context(), spill.release) {
+			runtime.SetFinalizer(spill, (*spillFile).close)
+		}
+		return func() io.ReadCloser {
+			return spill.reader()
+		}, nil
+	})
+}
+
+// NoReplayBodyStrategy sends original body with first attempt and uses request
+// GetBody function for other attempts. If GetBody is not set and request has
+// body, request is not retried. Instead, response of first attempt is returned
+// or, if attempt failed, NotReplayableError.
+func NoReplayBodyStrategy(r *http.Request) (func() io.ReadCloser, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return CacheBodyStrategy(r)
+	}
+	if r.GetBody != nil {
+		return GetBodyStrategy(r)
+	}
+	first := r.Body
+	return func() io.ReadCloser {
+		if first != nil {
+			body := first
+			first = nil
+			return body
+		}
+		return notReplayableBody{}
+	}, nil
+}
+
+// spillFile is temporary file that holds request body. It is closed once
+// all references to it are released, one is held by strategy and one by each
+// reader.
+type spillFile struct {
+	file    *os.File
+	size    int64
+	removed bool
+
+	mu   sync.Mutex
+	refs int
+}
+
+// newSpillFile writes content of provided reader to new temporary file.
+func newSpillFile(r io.Reader) (*spillFile, error) {
+	file, err := ioutil.TempFile("", "cliware-retry-body-")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	// on most platforms file can be removed while it is still open, it will
+	// actually be deleted once it is closed
+	removed := os.Remove(file.Name()) == nil
+	return &spillFile{file: file, size: size, removed: removed, refs: 1}, nil
+}
+
+// reader returns new reader of spill file content. File is not closed until
+// reader is closed.
+func (s *spillFile) reader() io.ReadCloser {
+	s.mu.Lock()
+	s.refs++
+	s.mu.Unlock()
+	return &spillReader{
+		SectionReader: io.NewSectionReader(s.file, 0, s.size),
+		spill:         s,
+	}
+}
+
+// release releases single reference to spill file and closes it if it was
+// the last one.
+func (s *spillFile) release() {
+	s.mu.Lock()
+	s.refs--
+	last := s.refs == 0
+	s.mu.Unlock()
+	if last {
+		s.close()
+	}
+}
+
+// close closes spill file and removes it, if it was not removed already.
+func (s *spillFile) close() {
+	s.file.Close()
+	if !s.removed {
+		os.Remove(s.file.Name())
+	}
+}
+
+// spillReader is body that reads content of spill file.
+type spillReader struct {
+	*io.SectionReader
+	spill *spillFile
+	once  sync.Once
+}
+
+func (r *spillReader) Close() error {
+	r.once.Do(r.spill.release)
+	return nil
+}
+
+// errorBody is body that fails with provided error when read.
+type errorBody struct {
+	err error
+}
+
+func (b errorBody) Read([]byte) (int, error) { return 0, b.err }
+func (b errorBody) Close() error             { return nil }
+
+// notReplayableBody is returned by body function when body can not be sent
+// again. Retry logic checks for it and stops retrying.
+type notReplayableBody struct{}
+
+func (notReplayableBody) Read([]byte) (int, error) { return 0, ErrBodyNotReplayable }
+func (notReplayableBody) Close() error             { return nil }
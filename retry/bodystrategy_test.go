@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+func readAll(t *testing.T, rc io.ReadCloser) string {
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Error("Error reading body:", err)
+	}
+	rc.Close()
+	return string(data)
+}
+
+func TestCacheBodyStrategy(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost", strings.NewReader("payload"))
+	getBody, err := CacheBodyStrategy(req)
+	if err != nil {
+		t.Fatal("CacheBodyStrategy returned error:", err)
+	}
+	for i := 0; i < 3; i++ {
+		if got := readAll(t, getBody()); got != "payload" {
+			t.Errorf("Wrong body. Got: %s, expected: payload.", got)
+		}
+	}
+}
+
+func TestGetBodyStrategy(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost", strings.NewReader("payload"))
+	calls := 0
+	getBodyFunc := req.GetBody
+	req.GetBody = func() (io.ReadCloser, error) {
+		calls++
+		return getBodyFunc()
+	}
+	getBody, err := GetBodyStrategy(req)
+	if err != nil {
+		t.Fatal("GetBodyStrategy returned error:", err)
+	}
+	for i := 0; i < 3; i++ {
+		if got := readAll(t, getBody()); got != "payload" {
+			t.Errorf("Wrong body. Got: %s, expected: payload.", got)
+		}
+	}
+	// original body is used for first attempt
+	if calls != 2 {
+		t.Errorf("Wrong number of GetBody calls. Got: %d, expected: 2.", calls)
+	}
+
+	req.GetBody = func() (io.ReadCloser, error) { return nil, errors.New("my error") }
+	getBody, _ = GetBodyStrategy(req)
+	getBody()
+	if _, err := getBody().Read(make([]byte, 1)); err == nil || err.Error() != "my error" {
+		t.Errorf("Wrong error. Got: %v, expected: my error.", err)
+	}
+}
+
+func TestFileBodyStrategy(t *testing.T) {
+	for _, data := range []struct {
+		Body      string
+		Threshold int64
+	}{
+		{Body: "payload", Threshold: 1024},
+		{Body: "payload", Threshold: 7},
+		{Body: strings.Repeat("payload", 1000), Threshold: 16},
+	} {
+		req, _ := http.NewRequest("POST", "http://localhost", ioutil.NopCloser(strings.NewReader(data.Body)))
+		getBody, err := FileBodyStrategy(data.Threshold)(req)
+		if err != nil {
+			t.Fatal("FileBodyStrategy returned error:", err)
+		}
+		for i := 0; i < 3; i++ {
+			if got := readAll(t, getBody()); got != data.Body {
+				t.Errorf("Wrong body. Got %d bytes, expected %d.", len(got), len(data.Body))
+			}
+		}
+	}
+}
+
+// spillRoundTripper reads and closes request bodies and records spill files
+// they were read from.
+type spillRoundTripper struct {
+	files []*os.File
+}
+
+func (rt *spillRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if body, ok := r.Body.(*spillReader); ok {
+		rt.files = append(rt.files, body.spill.file)
+	}
+	ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+}
+
+func TestRetryTransport_RoundTripClosesSpillFile(t *testing.T) {
+	mock := &spillRoundTripper{}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req.Method = "PUT"
+	req.Body = ioutil.NopCloser(strings.NewReader(strings.Repeat("payload", 100)))
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setClassifier(req.Context(), ErrorOr500Plus))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Duration(0))))
+	req = req.WithContext(setRetryMethods(req.Context(), "PUT"))
+	req = req.WithContext(setBodyStrategy(req.Context(), FileBodyStrategy(16)))
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal("RoundTrip returned error:", err)
+	}
+	if len(mock.files) != 3 {
+		t.Fatalf("Wrong number of attempts with spilled body. Got: %d, expected: 3.", len(mock.files))
+	}
+	if _, err := mock.files[0].Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Spill file not closed after retry cycle. Got: %v, expected: %v.", err, os.ErrClosed)
+	}
+}
+
+func TestNoReplayBodyStrategy(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost", ioutil.NopCloser(strings.NewReader("payload")))
+	getBody, err := NoReplayBodyStrategy(req)
+	if err != nil {
+		t.Fatal("NoReplayBodyStrategy returned error:", err)
+	}
+	if got := readAll(t, getBody()); got != "payload" {
+		t.Errorf("Wrong body. Got: %s, expected: payload.", got)
+	}
+	if _, ok := getBody().(notReplayableBody); !ok {
+		t.Error("Body replayed, but it should not be.")
+	}
+
+	// requests with GetBody can be replayed
+	req, _ = http.NewRequest("POST", "http://localhost", strings.NewReader("payload"))
+	getBody, _ = NoReplayBodyStrategy(req)
+	for i := 0; i < 3; i++ {
+		if got := readAll(t, getBody()); got != "payload" {
+			t.Errorf("Wrong body. Got: %s, expected: payload.", got)
+		}
+	}
+}
+
+func TestRetryTransport_RoundTripNotReplayable(t *testing.T) {
+	for _, data := range []struct {
+		Mock          *mockRoundTripper
+		ExpectedError bool
+	}{
+		{Mock: &mockRoundTripper{err: errors.New("my error")}, ExpectedError: true},
+		{Mock: &mockRoundTripper{response: &http.Response{StatusCode: 503}}, ExpectedError: false},
+	} {
+		transport := NewRetryTransport(data.Mock)
+		req := cliware.EmptyRequest()
+		req.Method = "PUT"
+		req.Body = ioutil.NopCloser(strings.NewReader("payload"))
+		req = req.WithContext(setClassifier(req.Context(), ErrorOr500Plus))
+		req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Duration(0))))
+		req = req.WithContext(setRetryMethods(req.Context(), "PUT"))
+		req = req.WithContext(setBodyStrategy(req.Context(), NoReplayBodyStrategy))
+
+		resp, err := transport.RoundTrip(req)
+		if data.Mock.calledCount != 1 {
+			t.Errorf("Wrong number of calls. Got: %d, expected: 1.", data.Mock.calledCount)
+		}
+		if data.ExpectedError {
+			notReplayable, ok := err.(*NotReplayableError)
+			if !ok {
+				t.Fatalf("Wrong error. Got: %T, expected: *NotReplayableError.", err)
+			}
+			if notReplayable.Err != data.Mock.err {
+				t.Errorf("Wrong wrapped error. Got: %v, expected: %v.", notReplayable.Err, data.Mock.err)
+			}
+		} else if err != nil || resp != data.Mock.response {
+			t.Errorf("Expected response of first attempt, got: %v, %v.", resp, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// budgetBuckets is number of buckets sliding window of Budget is divided into.
+const budgetBuckets = 10
+
+// Budget limits number of retries relative to number of original requests,
+// modelled after retry budgets from gRPC and Finagle. Within sliding window,
+// number of retries is allowed to be at most minRetries plus ratio of
+// original requests. Single Budget is meant to be shared between many
+// requests (usually all requests to same backend), so that during outage
+// retries do not multiply load on failing backend.
+//
+// Budget is safe for concurrent use.
+type Budget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	epochs   [budgetBuckets]int64
+	requests [budgetBuckets]int
+	retries  [budgetBuckets]int
+}
+
+// NewBudget creates new Budget with provided sliding window. Within window
+// number of retries can be at most minRetries plus ratio of original requests
+// (e.g. ratio 0.2 allows one retry per five requests).
+func NewBudget(window time.Duration, ratio float64, minRetries int) *Budget {
+	bucketSize := window / budgetBuckets
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	return &Budget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		bucketSize: bucketSize,
+		now:        time.Now,
+	}
+}
+
+// deposit records original request.
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests[b.bucket()]++
+}
+
+// withdraw records retry if budget allows it. Returned value indicates if
+// retry is allowed.
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := b.bucket()
+	requests, retries := 0, 0
+	for i := range b.epochs {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+	if float64(retries) >= float64(b.minRetries)+b.ratio*float64(requests) {
+		return false
+	}
+	b.retries[current]++
+	return true
+}
+
+// bucket returns index of bucket for current time, resetting buckets that
+// fell out of sliding window. Caller has to hold lock.
+func (b *Budget) bucket() int {
+	epoch := b.now().UnixNano() / int64(b.bucketSize)
+	for i := range b.epochs {
+		if b.epochs[i] <= epoch-budgetBuckets {
+			b.epochs[i] = 0
+			b.requests[i] = 0
+			b.retries[i] = 0
+		}
+	}
+	current := int(epoch % budgetBuckets)
+	if b.epochs[current] != epoch {
+		b.epochs[current] = epoch
+		b.requests[current] = 0
+		b.retries[current] = 0
+	}
+	return current
+}
@@ -0,0 +1,83 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+func TestBudget(t *testing.T) {
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	budget := NewBudget(10*time.Second, 0.5, 1)
+	budget.now = func() time.Time { return now }
+
+	// minimum retries are always allowed
+	if !budget.withdraw() {
+		t.Error("Budget did not allow minimum retries.")
+	}
+	if budget.withdraw() {
+		t.Error("Budget allowed retry over minimum without requests.")
+	}
+
+	// every two requests allow one retry
+	for i := 0; i < 4; i++ {
+		budget.deposit()
+	}
+	for i := 0; i < 2; i++ {
+		if !budget.withdraw() {
+			t.Errorf("Budget did not allow retry %d.", i)
+		}
+	}
+	if budget.withdraw() {
+		t.Error("Budget allowed retry over ratio.")
+	}
+
+	// once window passes, everything is forgotten
+	now = now.Add(11 * time.Second)
+	if !budget.withdraw() {
+		t.Error("Budget did not allow retry in new window.")
+	}
+	if budget.withdraw() {
+		t.Error("Budget remembered requests from previous window.")
+	}
+}
+
+func TestBudgetSlidingWindow(t *testing.T) {
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	budget := NewBudget(10*time.Second, 1, 0)
+	budget.now = func() time.Time { return now }
+
+	budget.deposit()
+	now = now.Add(5 * time.Second)
+	budget.deposit()
+	now = now.Add(6 * time.Second)
+	// first request fell out of window, second one is still in it
+	if !budget.withdraw() {
+		t.Error("Budget did not allow retry for request in window.")
+	}
+	if budget.withdraw() {
+		t.Error("Budget allowed retry for request out of window.")
+	}
+}
+
+func TestRetryTransport_RoundTripBudget(t *testing.T) {
+	budget := NewBudget(time.Minute, 0, 2)
+	mock := &mockRoundTripper{response: &http.Response{StatusCode: 500}}
+	transport := NewRetryTransport(mock)
+	for _, expectedCalls := range []int{3, 4, 5} {
+		req := cliware.EmptyRequest()
+		req = req.WithContext(setClassifier(req.Context(), On500PlusClassifier))
+		req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(0)))
+		req = req.WithContext(setRetryTimes(req.Context(), 5))
+		req = req.WithContext(setBudget(req.Context(), budget))
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Error("retryTransport returned error:", err)
+		}
+		// first request spends whole budget, others are not retried
+		if mock.calledCount != expectedCalls {
+			t.Errorf("Wrong number of calls. Got: %d, expected: %d.", mock.calledCount, expectedCalls)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package retry
 
-import "net/http"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
 
 // Classifier is function that determines if request should be retried.
 // Boolean return value indicates if request should be repeated or not.
@@ -58,6 +66,104 @@ func AndClassifier(classifiers ...Classifier) Classifier {
 	})
 }
 
+// OnStatusClassifier returns classifier that indicates that requests whose
+// response code is one of provided codes should be repeated.
+func OnStatusClassifier(codes ...int) Classifier {
+	return Classifier(func(resp *http.Response, err error) bool {
+		if resp == nil {
+			return false
+		}
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// HeaderClassifier returns classifier that indicates that requests whose
+// response contains provided header with provided value (compared case
+// insensitively) should be repeated. For example, HeaderClassifier("X-Retryable", "true").
+func HeaderClassifier(header, value string) Classifier {
+	return Classifier(func(resp *http.Response, err error) bool {
+		if resp == nil {
+			return false
+		}
+		for _, v := range resp.Header[http.CanonicalHeaderKey(header)] {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// NetErrorClassifier is classifier that indicates that requests which failed
+// with net.Error that is timeout or temporary should be repeated. Temporary
+// is deprecated, but it is still checked deliberately, since some errors that
+// are not timeouts (e.g. temporary DNS failures) report themselves as
+// transient only through it.
+func NetErrorClassifier(resp *http.Response, err error) bool {
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return false
+	}
+	return netErr.Timeout() || netErr.Temporary()
+}
+
+// ConnectionRefusedClassifier is classifier that indicates that requests which
+// failed because connection was refused should be repeated.
+func ConnectionRefusedClassifier(resp *http.Response, err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// ConnectionResetClassifier is classifier that indicates that requests which
+// failed because connection was reset by peer should be repeated.
+func ConnectionResetClassifier(resp *http.Response, err error) bool {
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// TLSHandshakeClassifier is classifier that indicates that requests which
+// failed because peer aborted TLS handshake with alert should be repeated.
+// Certificate verification failures and malformed TLS records (usually
+// caused by server that does not speak TLS) are permanent and are never
+// repeated. Handshake timeouts can not be told apart from other timeouts, so
+// they are not matched by this classifier, combine it with
+// NetErrorClassifier to repeat them.
+func TLSHandshakeClassifier(resp *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		verificationErr *tls.CertificateVerificationError
+		authorityErr    x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidErr      x509.CertificateInvalidError
+	)
+	if errors.As(err, &verificationErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+	var (
+		alertErr tls.AlertError
+		opErr    *net.OpError
+	)
+	if errors.As(err, &alertErr) {
+		return true
+	}
+	// alerts received from peer are reported as net.OpError with unexported
+	// alert type
+	return errors.As(err, &opErr) && opErr.Op == "remote error"
+}
+
+// NotClassifier returns classifier that negates result of provided classifier.
+func NotClassifier(classifier Classifier) Classifier {
+	return Classifier(func(resp *http.Response, err error) bool {
+		return !classifier(resp, err)
+	})
+}
+
 // ErrorOr500Plus is classifier that combines AnyError and On500Plus classifiers.
 // This means that classifier will classify any response that returned error or
 // status code >= 500 to be retried.
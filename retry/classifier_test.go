@@ -7,6 +7,13 @@ import (
 
 	"errors"
 
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+
 	"github.com/delicb/cliware-middlewares/retry"
 )
 
@@ -102,3 +109,119 @@ func TestAndClassifier(t *testing.T) {
 		}
 	}
 }
+
+func TestOnStatusClassifier(t *testing.T) {
+	classifier := retry.OnStatusClassifier(429, 503)
+	for _, data := range []struct {
+		Response *http.Response
+		Result   bool
+	}{
+		{Response: nil, Result: false},
+		{Response: &http.Response{StatusCode: 200}, Result: false},
+		{Response: &http.Response{StatusCode: 429}, Result: true},
+		{Response: &http.Response{StatusCode: 500}, Result: false},
+		{Response: &http.Response{StatusCode: 503}, Result: true},
+	} {
+		if res := classifier(data.Response, nil); res != data.Result {
+			t.Errorf("OnStatusClassifier returned wrong value. Got: %t, expected: %t.", res, data.Result)
+		}
+	}
+}
+
+func TestHeaderClassifier(t *testing.T) {
+	classifier := retry.HeaderClassifier("x-retryable", "true")
+	for _, data := range []struct {
+		Header http.Header
+		Result bool
+	}{
+		{Header: http.Header{}, Result: false},
+		{Header: http.Header{"X-Retryable": {"false"}}, Result: false},
+		{Header: http.Header{"X-Retryable": {"true"}}, Result: true},
+		{Header: http.Header{"X-Retryable": {" TRUE"}}, Result: true},
+	} {
+		if res := classifier(&http.Response{Header: data.Header}, nil); res != data.Result {
+			t.Errorf("HeaderClassifier returned wrong value for %v. Got: %t, expected: %t.", data.Header, res, data.Result)
+		}
+	}
+	if classifier(nil, errors.New("some error")) {
+		t.Error("HeaderClassifier returned true for nil response.")
+	}
+}
+
+// timeoutError is net.Error that reports timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestNetErrorClassifier(t *testing.T) {
+	for _, data := range []struct {
+		Err    error
+		Result bool
+	}{
+		{Err: nil, Result: false},
+		{Err: errors.New("some error"), Result: false},
+		{Err: timeoutError{}, Result: true},
+		{Err: &url.Error{Op: "Get", URL: "http://localhost", Err: timeoutError{}}, Result: true},
+		{Err: &net.OpError{Op: "dial", Err: errors.New("some error")}, Result: false},
+	} {
+		if res := retry.NetErrorClassifier(nil, data.Err); res != data.Result {
+			t.Errorf("NetErrorClassifier returned wrong value for %v. Got: %t, expected: %t.", data.Err, res, data.Result)
+		}
+	}
+}
+
+func TestConnectionClassifiers(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://localhost", Err: &net.OpError{
+		Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}}
+	reset := &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	for _, data := range []struct {
+		Classifier retry.Classifier
+		Err        error
+		Result     bool
+	}{
+		{Classifier: retry.ConnectionRefusedClassifier, Err: refused, Result: true},
+		{Classifier: retry.ConnectionRefusedClassifier, Err: reset, Result: false},
+		{Classifier: retry.ConnectionRefusedClassifier, Err: nil, Result: false},
+		{Classifier: retry.ConnectionResetClassifier, Err: reset, Result: true},
+		{Classifier: retry.ConnectionResetClassifier, Err: refused, Result: false},
+		{Classifier: retry.ConnectionResetClassifier, Err: nil, Result: false},
+	} {
+		if res := data.Classifier(nil, data.Err); res != data.Result {
+			t.Errorf("Classifier returned wrong value for %v. Got: %t, expected: %t.", data.Err, res, data.Result)
+		}
+	}
+}
+
+func TestTLSHandshakeClassifier(t *testing.T) {
+	for _, data := range []struct {
+		Err    error
+		Result bool
+	}{
+		{Err: nil, Result: false},
+		{Err: errors.New("some error"), Result: false},
+		{Err: &url.Error{Op: "Get", URL: "https://localhost", Err: x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}}, Result: false},
+		{Err: &url.Error{Op: "Get", URL: "https://localhost", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, Result: false},
+		{Err: x509.HostnameError{Host: "localhost"}, Result: false},
+		{Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, Result: false},
+		{Err: &url.Error{Op: "Get", URL: "https://localhost", Err: &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}}, Result: true},
+		{Err: tls.AlertError(40), Result: true},
+		{Err: &url.Error{Op: "Get", URL: "https://localhost", Err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}}, Result: false},
+		{Err: errors.New("tls: handshake failure"), Result: false},
+	} {
+		if res := retry.TLSHandshakeClassifier(nil, data.Err); res != data.Result {
+			t.Errorf("TLSHandshakeClassifier returned wrong value for %v. Got: %t, expected: %t.", data.Err, res, data.Result)
+		}
+	}
+}
+
+func TestNotClassifier(t *testing.T) {
+	if retry.NotClassifier(trueClassifier)(nil, nil) {
+		t.Error("NotClassifier returned true for true classifier.")
+	}
+	if !retry.NotClassifier(falseClassifier)(nil, nil) {
+		t.Error("NotClassifier returned false for false classifier.")
+	}
+}
@@ -2,6 +2,8 @@ package retry
 
 import (
 	"context"
+	"net/http"
+	"sync"
 	"time"
 )
 
@@ -16,6 +18,17 @@ var (
 	classifierKey   retryConfigKey = "classifier"
 	bodyStrategyKey retryConfigKey = "body-strategy"
 	retryMethodsKey retryConfigKey = "retry-methods"
+	retryAfterKey   retryConfigKey = "retry-after"
+	drainLimitKey   retryConfigKey = "drain-limit"
+	discardHookKey  retryConfigKey = "discard-hook"
+	attemptTimeKey  retryConfigKey = "attempt-timeout"
+	onRetryKey      retryConfigKey = "on-retry"
+	statsKey        retryConfigKey = "stats"
+	budgetKey       retryConfigKey = "budget"
+	hedgeKey        retryConfigKey = "hedge"
+	policyKey       retryConfigKey = "policy"
+	attemptKey      retryConfigKey = "attempt"
+	cleanupKey      retryConfigKey = "cleanup"
 )
 
 // setRetryTimes sets provided number of retry times to provided context and
@@ -114,3 +127,205 @@ func getRetryMethods(ctx context.Context) []string {
 	}
 	return retryMethods.([]string)
 }
+
+// setRetryAfterMax sets provided maximum duration that will be honored from
+// Retry-After response header to provided context and returns new context.
+func setRetryAfterMax(ctx context.Context, max time.Duration) context.Context {
+	return context.WithValue(ctx, retryAfterKey, max)
+}
+
+// getRetryAfterMax returns maximum duration that will be honored from
+// Retry-After response header and true if provided context contains it, or
+// time.Duration(0) and false if Retry-After should not be respected.
+func getRetryAfterMax(ctx context.Context) (time.Duration, bool) {
+	max := ctx.Value(retryAfterKey)
+	if max == nil {
+		return time.Duration(0), false
+	}
+	return max.(time.Duration), true
+}
+
+// setDrainLimit sets provided maximum number of bytes to read from discarded
+// response bodies to provided context and returns new context.
+func setDrainLimit(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, drainLimitKey, limit)
+}
+
+// getDrainLimit returns maximum number of bytes to read from discarded response
+// bodies from provided context or -1 if provided context does not contain
+// value for drain limit.
+func getDrainLimit(ctx context.Context) int64 {
+	limit := ctx.Value(drainLimitKey)
+	if limit == nil {
+		return -1
+	}
+	return limit.(int64)
+}
+
+// setDiscardHook sets provided function to be called for discarded responses
+// to provided context and returns new context.
+func setDiscardHook(ctx context.Context, hook func(*http.Response)) context.Context {
+	return context.WithValue(ctx, discardHookKey, hook)
+}
+
+// getDiscardHook returns function to be called for discarded responses from
+// provided context or nil if provided context does not contain value for it.
+func getDiscardHook(ctx context.Context) func(*http.Response) {
+	hook := ctx.Value(discardHookKey)
+	if hook == nil {
+		return nil
+	}
+	return hook.(func(*http.Response))
+}
+
+// setPerAttemptTimeout sets provided timeout for single request attempt to
+// provided context and returns new context.
+func setPerAttemptTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, attemptTimeKey, timeout)
+}
+
+// getPerAttemptTimeout returns timeout for single request attempt from provided
+// context or time.Duration(0) if provided context does not contain value for
+// per attempt timeout.
+func getPerAttemptTimeout(ctx context.Context) time.Duration {
+	timeout := ctx.Value(attemptTimeKey)
+	if timeout == nil {
+		return time.Duration(0)
+	}
+	return timeout.(time.Duration)
+}
+
+// setOnRetry sets provided function to be called before each retry to
+// provided context and returns new context.
+func setOnRetry(ctx context.Context, hook OnRetryFunc) context.Context {
+	return context.WithValue(ctx, onRetryKey, hook)
+}
+
+// getOnRetry returns function to be called before each retry from provided
+// context or nil if provided context does not contain value for it.
+func getOnRetry(ctx context.Context) OnRetryFunc {
+	hook := ctx.Value(onRetryKey)
+	if hook == nil {
+		return nil
+	}
+	return hook.(OnRetryFunc)
+}
+
+// setStats sets provided stats to provided context and returns new context.
+func setStats(ctx context.Context, stats *Stats) context.Context {
+	return context.WithValue(ctx, statsKey, stats)
+}
+
+// getStats returns stats from provided context or nil if provided context
+// does not contain value for stats.
+func getStats(ctx context.Context) *Stats {
+	stats := ctx.Value(statsKey)
+	if stats == nil {
+		return nil
+	}
+	return stats.(*Stats)
+}
+
+// setBudget sets provided retry budget to provided context and returns new
+// context.
+func setBudget(ctx context.Context, budget *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey, budget)
+}
+
+// getBudget returns retry budget from provided context or nil if provided
+// context does not contain value for budget.
+func getBudget(ctx context.Context) *Budget {
+	budget := ctx.Value(budgetKey)
+	if budget == nil {
+		return nil
+	}
+	return budget.(*Budget)
+}
+
+// setHedge sets provided hedging policy to provided context and returns new
+// context.
+func setHedge(ctx context.Context, hedge hedgePolicy) context.Context {
+	return context.WithValue(ctx, hedgeKey, hedge)
+}
+
+// getHedge returns hedging policy from provided context or zero policy
+// (hedging disabled) if provided context does not contain value for it.
+func getHedge(ctx context.Context) hedgePolicy {
+	hedge := ctx.Value(hedgeKey)
+	if hedge == nil {
+		return hedgePolicy{}
+	}
+	return hedge.(hedgePolicy)
+}
+
+// setPolicy sets provided retry policy to provided context and returns new
+// context.
+func setPolicy(ctx context.Context, policy *Policy) context.Context {
+	return context.WithValue(ctx, policyKey, policy)
+}
+
+// getPolicy returns retry policy from provided context or nil if provided
+// context does not contain value for policy.
+func getPolicy(ctx context.Context) *Policy {
+	policy := ctx.Value(policyKey)
+	if policy == nil {
+		return nil
+	}
+	return policy.(*Policy)
+}
+
+// setAttempt sets provided attempt number to provided context and returns
+// new context.
+func setAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey, attempt)
+}
+
+// Attempt returns number of attempt (starting from 1) of request with
+// provided context. Retry RoundTripper sets it on each request it sends to
+// underlying RoundTripper, so it can be used there, e.g. for logging. Zero
+// is returned for requests not sent by retry RoundTripper.
+func Attempt(ctx context.Context) int {
+	attempt := ctx.Value(attemptKey)
+	if attempt == nil {
+		return 0
+	}
+	return attempt.(int)
+}
+
+// cleanups holds functions that release resources that are needed until
+// retry RoundTripper finishes with request.
+type cleanups struct {
+	mu    sync.Mutex
+	funcs []func()
+}
+
+// run calls all registered functions.
+func (c *cleanups) run() {
+	c.mu.Lock()
+	funcs := c.funcs
+	c.funcs = nil
+	c.mu.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
+// setCleanups sets provided cleanups to provided context and returns new
+// context.
+func setCleanups(ctx context.Context, c *cleanups) context.Context {
+	return context.WithValue(ctx, cleanupKey, c)
+}
+
+// onRetryDone registers provided function to be called once retry
+// RoundTripper finishes with request with provided context. False is returned
+// if request is not sent by retry RoundTripper, so function is never called.
+func onRetryDone(ctx context.Context, f func()) bool {
+	c, ok := ctx.Value(cleanupKey).(*cleanups)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	c.funcs = append(c.funcs, f)
+	c.mu.Unlock()
+	return true
+}
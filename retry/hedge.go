@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// hedgePolicy holds configuration for hedged requests.
+type hedgePolicy struct {
+	Delay     time.Duration
+	MaxHedges int
+}
+
+// hedgeResult is outcome of single copy of hedged request.
+type hedgeResult struct {
+	index    int
+	resp     *http.Response
+	timedOut bool
+	err      error
+}
+
+// hedgedAttempt sends provided request with provided body and, while no
+// response arrives, sends additional copies of it (with bodies obtained from
+// getBody) after configured delay. First successful response is returned and
+// all other copies are cancelled. If all copies fail, result of last one is
+// returned.
+func (t *retryTransport) hedgedAttempt(r *http.Request, body io.ReadCloser, getBody func() io.ReadCloser, config *retryTransportConfig) (*http.Response, bool, error) {
+	results := make(chan hedgeResult, config.Hedge.MaxHedges+1)
+	var cancels []context.CancelFunc
+	send := func(body io.ReadCloser) {
+		ctx, cancel := context.WithCancel(r.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		reqCopy := r.WithContext(ctx)
+		reqCopy.Body = body
+		go func() {
+			resp, timedOut, err := t.attempt(reqCopy, config.AttemptTimeout)
+			results <- hedgeResult{index: index, resp: resp, timedOut: timedOut, err: err}
+		}()
+	}
+
+	send(body)
+	inFlight := 1
+	timer := time.NewTimer(config.Hedge.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) > config.Hedge.MaxHedges {
+				continue
+			}
+			body := getBody()
+			if _, ok := body.(notReplayableBody); ok {
+				continue
+			}
+			if config.Budget != nil && !config.Budget.withdraw() {
+				body.Close()
+				continue
+			}
+			send(body)
+			inFlight++
+			timer.Reset(config.Hedge.Delay)
+		case res := <-results:
+			inFlight--
+			if res.err != nil && inFlight > 0 {
+				// some other copy might still succeed
+				config.discard(res.resp)
+				continue
+			}
+			for i, cancel := range cancels {
+				if i != res.index {
+					cancel()
+				}
+			}
+			if res.resp != nil && res.resp.Body != nil {
+				res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancels[res.index]}
+			} else {
+				cancels[res.index]()
+			}
+			// responses of cancelled copies still have to be released
+			go func(pending int) {
+				for i := 0; i < pending; i++ {
+					config.discard((<-results).resp)
+				}
+			}(inFlight)
+			return res.resp, res.timedOut, res.err
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package retry
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// slowRoundTripper blocks first slow calls until request context is done and
+// responds immediately to all other calls with number of call in body.
+type slowRoundTripper struct {
+	slow int
+
+	mu        sync.Mutex
+	called    int
+	cancelled int
+	bodies    []string
+}
+
+func (rt *slowRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(r.Body)
+	rt.mu.Lock()
+	rt.called++
+	call := rt.called
+	rt.bodies = append(rt.bodies, string(body))
+	rt.mu.Unlock()
+	if call <= rt.slow {
+		<-r.Context().Done()
+		rt.mu.Lock()
+		rt.cancelled++
+		rt.mu.Unlock()
+		return nil, r.Context().Err()
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(strings.Repeat("x", call))),
+	}, nil
+}
+
+func (rt *slowRoundTripper) stats() (called, cancelled int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.called, rt.cancelled
+}
+
+func TestRetryTransport_RoundTripHedge(t *testing.T) {
+	mock := &slowRoundTripper{slow: 2}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req.Body = ioutil.NopCloser(strings.NewReader("payload"))
+	req = req.WithContext(setHedge(req.Context(), hedgePolicy{Delay: 10 * time.Millisecond, MaxHedges: 3}))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("retryTransport returned error:", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "xxx" {
+		t.Errorf("Wrong response used. Got body: %s, expected: xxx.", body)
+	}
+
+	// slow copies are cancelled in background
+	deadline := time.Now().Add(time.Second)
+	for {
+		called, cancelled := mock.stats()
+		if called == 3 && cancelled == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wrong calls. Got: %d calls and %d cancelled, expected 3 and 2.", called, cancelled)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	for _, b := range mock.bodies {
+		if b != "payload" {
+			t.Errorf("Wrong body of hedged request. Got: %s, expected: payload.", b)
+		}
+	}
+}
+
+// roundTripperFunc is function that implements http.RoundTripper interface.
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// signalBody is response body that sends number of bytes read from it to
+// closed channel when it is closed.
+type signalBody struct {
+	io.Reader
+	read   int
+	closed chan int
+}
+
+func (b *signalBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *signalBody) Close() error {
+	b.closed <- b.read
+	return nil
+}
+
+func TestRetryTransport_RoundTripHedgeDiscard(t *testing.T) {
+	closed := make(chan int, 1)
+	var calls int32
+	mock := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// first copy responds late and ignores cancellation
+			time.Sleep(50 * time.Millisecond)
+			return &http.Response{StatusCode: 200, Body: &signalBody{Reader: strings.NewReader("late"), closed: closed}}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	discarded := make(chan *http.Response, 1)
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setHedge(req.Context(), hedgePolicy{Delay: 10 * time.Millisecond, MaxHedges: 1}))
+	req = req.WithContext(setDrainLimit(req.Context(), 2))
+	req = req.WithContext(setDiscardHook(req.Context(), func(resp *http.Response) {
+		discarded <- resp
+	}))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("retryTransport returned error:", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-discarded:
+	case <-time.After(time.Second):
+		t.Fatal("Discard hook not called for losing copy.")
+	}
+	select {
+	case read := <-closed:
+		if read != 2 {
+			t.Errorf("Wrong number of bytes drained. Got: %d, expected: 2.", read)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Body of losing copy not closed.")
+	}
+}
+
+func TestRetryTransport_RoundTripHedgeMethod(t *testing.T) {
+	mock := &slowRoundTripper{slow: 0}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req.Method = "POST"
+	req = req.WithContext(setHedge(req.Context(), hedgePolicy{Delay: 0, MaxHedges: 3}))
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal("retryTransport returned error:", err)
+	}
+	if called, _ := mock.stats(); called != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", called)
+	}
+}
+
+func TestRetryTransport_RoundTripHedgeBudget(t *testing.T) {
+	mock := &slowRoundTripper{slow: 1}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setHedge(req.Context(), hedgePolicy{Delay: 5 * time.Millisecond, MaxHedges: 3}))
+	req = req.WithContext(setBudget(req.Context(), NewBudget(time.Minute, 0, 0)))
+	req = req.WithContext(setPerAttemptTimeout(req.Context(), 50*time.Millisecond))
+	req = req.WithContext(setRetryTimes(req.Context(), 1))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(0)))
+
+	// budget does not allow any hedges (or retries), so first copy times out
+	_, err := transport.RoundTrip(req)
+	if err == nil {
+		t.Error("Expected error, got nil.")
+	}
+	if called, _ := mock.stats(); called != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", called)
+	}
+}
@@ -2,6 +2,8 @@ package retry
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
 	"net/http"
 
 	"time"
@@ -57,3 +59,149 @@ func Methods(methods ...string) c.Middleware {
 		return setRetryMethods(ctx, methods...)
 	}))
 }
+
+// RespectRetryAfter instructs retry logic to wait for duration server requested
+// via Retry-After response header (both delta-seconds and HTTP-date forms are
+// supported) instead of duration calculated by backoff strategy. Durations
+// longer than provided max are capped to max. If max is not positive, duration
+// requested by server is used as is. If response does not contain valid
+// Retry-After header, backoff strategy is used.
+func RespectRetryAfter(max time.Duration) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setRetryAfterMax(ctx, max)
+	})
+}
+
+// DrainLimit sets maximum number of bytes that will be read from body of
+// response that is discarded because request is retried. Reading body before
+// closing it allows underlying transport to reuse connection. If body is
+// larger than limit, connection is closed instead. Zero disables draining.
+func DrainLimit(limit int64) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setDrainLimit(ctx, limit)
+	})
+}
+
+// OnDiscardedResponse sets function that will be called with every response
+// that is discarded because request is retried or because other copy of
+// hedged request won. Hook is called before response body is drained and
+// closed, so it is free to read it, but it should not keep reference to
+// response after it returns. For hedged requests, hook might be called
+// concurrently.
+func OnDiscardedResponse(hook func(*http.Response)) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setDiscardHook(ctx, hook)
+	})
+}
+
+// PerAttemptTimeout sets maximum amount of time single request attempt can
+// take, including reading of response body. Attempt that times out is
+// retried regardless of classifier, while limits set by other middlewares
+// and deadline of request context are still respected.
+func PerAttemptTimeout(timeout time.Duration) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setPerAttemptTimeout(ctx, timeout)
+	})
+}
+
+// OnRetryFunc is function called before each retry. Attempt is number of retry
+// that is about to be made (starting from 1), resp and err are result of
+// previous attempt and wait is time that will pass before retry is sent.
+type OnRetryFunc func(attempt int, resp *http.Response, err error, wait time.Duration)
+
+// OnRetry sets function that will be called before waiting for each retry.
+// Response passed to it will be discarded after hook returns, so hook should
+// not keep reference to it.
+func OnRetry(hook func(attempt int, resp *http.Response, err error, wait time.Duration)) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setOnRetry(ctx, OnRetryFunc(hook))
+	})
+}
+
+// Stats holds information about retry process of single request.
+type Stats struct {
+	// Attempts is number of times request was sent, including first one.
+	Attempts int
+	// Elapsed is total time spent sending request, including all retries
+	// and time spent waiting between them.
+	Elapsed time.Duration
+}
+
+// CollectStats sets provided stats to be populated once request is finished.
+// Stats are written by retry RoundTripper, so they are available after
+// request returns. Same stats should not be used for concurrent requests.
+func CollectStats(stats *Stats) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setStats(ctx, stats)
+	})
+}
+
+// WithBudget sets retry budget that request will use. Every request sent is
+// recorded in budget and retrying stops early once budget is exhausted. Same
+// budget should be shared by requests that go to same backend.
+func WithBudget(budget *Budget) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setBudget(ctx, budget)
+	})
+}
+
+// IdempotencyKeyHeader is name of header that carries idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKey marks request as idempotent by setting Idempotency-Key header
+// to randomly generated value. If request already has this header (e.g. set by
+// headers.Set middleware), provided value is kept. Since middleware is
+// executed once per request, same key is sent with every retry. Requests that
+// contain Idempotency-Key header are retried regardless of their method.
+func IdempotencyKey() c.Middleware {
+	return c.RequestProcessor(func(req *http.Request) error {
+		if req.Header.Get(IdempotencyKeyHeader) != "" {
+			return nil
+		}
+		key, err := newIdempotencyKey()
+		if err != nil {
+			return err
+		}
+		req.Header.Set(IdempotencyKeyHeader, key)
+		return nil
+	})
+}
+
+// newIdempotencyKey returns random (version 4) UUID.
+func newIdempotencyKey() (string, error) {
+	var uuid [16]byte
+	if _, err := io.ReadFull(rand.Reader, uuid[:]); err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// Hedge enables hedged requests. If response to request does not arrive within
+// provided delay, another copy of request is sent, up to maxHedges additional
+// copies, each one after another delay. First successful response is used
+// and all other copies are cancelled. Only requests that are safe to retry
+// (see Methods and IdempotencyKey) are hedged and request body is replayed
+// using configured body strategy. If retry budget is set, every additional
+// copy is withdrawn from it.
+func Hedge(delay time.Duration, maxHedges int) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setHedge(ctx, hedgePolicy{Delay: delay, MaxHedges: maxHedges})
+	})
+}
+
+// UsePolicy sets retry policy for request. Policy takes precedence over policy
+// selected by PolicyRouter, while values set by other middlewares from this
+// package take precedence over policy. Policy is validated when middleware is
+// created and invalid policy makes every request fail.
+func UsePolicy(policy *Policy) c.Middleware {
+	if err := policy.Validate(); err != nil {
+		return c.RequestProcessor(func(req *http.Request) error {
+			return err
+		})
+	}
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setPolicy(ctx, policy)
+	})
+}
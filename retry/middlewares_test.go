@@ -124,6 +124,148 @@ func TestMethods(t *testing.T) {
 	}
 }
 
+func TestRespectRetryAfter(t *testing.T) {
+	for _, max := range []time.Duration{0, time.Second, time.Minute} {
+		m := RespectRetryAfter(max)
+		initialContext := context.Background()
+		req := cliware.EmptyRequest().WithContext(initialContext)
+		resp, err := m.Exec(createHandler()).Handle(req)
+		if err != nil {
+			t.Error("Handle returned error:", err)
+		}
+		got, ok := getRetryAfterMax(resp.Request.Context())
+		if !ok {
+			t.Error("Retry-After not enabled.")
+		}
+		if got != max {
+			t.Errorf("Wrong Retry-After max. Got: %s, expected: %s.", got, max)
+		}
+	}
+}
+
+func TestDrainLimit(t *testing.T) {
+	for _, limit := range []int64{0, 1024, 1 << 20} {
+		m := DrainLimit(limit)
+		initialContext := context.Background()
+		req := cliware.EmptyRequest().WithContext(initialContext)
+		resp, err := m.Exec(createHandler()).Handle(req)
+		if err != nil {
+			t.Error("Handle returned error:", err)
+		}
+		got := getDrainLimit(resp.Request.Context())
+		if got != limit {
+			t.Errorf("Wrong drain limit. Got: %d, expected: %d.", got, limit)
+		}
+	}
+}
+
+func TestOnDiscardedResponse(t *testing.T) {
+	m := OnDiscardedResponse(func(resp *http.Response) {})
+	initialContext := context.Background()
+	req := cliware.EmptyRequest().WithContext(initialContext)
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	// can not really compare functions, so just check if we got non-nil value
+	if getDiscardHook(resp.Request.Context()) == nil {
+		t.Error("Wrong discard hook. Got nil.")
+	}
+}
+
+func TestPerAttemptTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second, time.Minute} {
+		m := PerAttemptTimeout(timeout)
+		initialContext := context.Background()
+		req := cliware.EmptyRequest().WithContext(initialContext)
+		resp, err := m.Exec(createHandler()).Handle(req)
+		if err != nil {
+			t.Error("Handle returned error:", err)
+		}
+		got := getPerAttemptTimeout(resp.Request.Context())
+		if got != timeout {
+			t.Errorf("Wrong per attempt timeout. Got: %s, expected: %s.", got, timeout)
+		}
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	m := OnRetry(func(attempt int, resp *http.Response, err error, wait time.Duration) {})
+	initialContext := context.Background()
+	req := cliware.EmptyRequest().WithContext(initialContext)
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	// can not really compare functions, so just check if we got non-nil value
+	if getOnRetry(resp.Request.Context()) == nil {
+		t.Error("Wrong OnRetry hook. Got nil.")
+	}
+}
+
+func TestCollectStats(t *testing.T) {
+	stats := &Stats{}
+	m := CollectStats(stats)
+	initialContext := context.Background()
+	req := cliware.EmptyRequest().WithContext(initialContext)
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	if got := getStats(resp.Request.Context()); got != stats {
+		t.Errorf("Wrong stats. Got: %p, expected: %p.", got, stats)
+	}
+}
+
+func TestWithBudget(t *testing.T) {
+	budget := NewBudget(time.Minute, 0.1, 10)
+	m := WithBudget(budget)
+	initialContext := context.Background()
+	req := cliware.EmptyRequest().WithContext(initialContext)
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	if got := getBudget(resp.Request.Context()); got != budget {
+		t.Errorf("Wrong budget. Got: %p, expected: %p.", got, budget)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	for _, preset := range []string{"", "my-key"} {
+		m := IdempotencyKey()
+		req := cliware.EmptyRequest()
+		if preset != "" {
+			req.Header.Set(IdempotencyKeyHeader, preset)
+		}
+		_, err := m.Exec(createHandler()).Handle(req)
+		if err != nil {
+			t.Error("Handle returned error:", err)
+		}
+		got := req.Header.Get(IdempotencyKeyHeader)
+		if preset != "" && got != preset {
+			t.Errorf("Wrong idempotency key. Got: %s, expected: %s.", got, preset)
+		}
+		if preset == "" && len(got) != 36 {
+			t.Errorf("Wrong generated idempotency key: %s.", got)
+		}
+	}
+}
+
+func TestHedge(t *testing.T) {
+	m := Hedge(time.Second, 2)
+	initialContext := context.Background()
+	req := cliware.EmptyRequest().WithContext(initialContext)
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	expected := hedgePolicy{Delay: time.Second, MaxHedges: 2}
+	if got := getHedge(resp.Request.Context()); got != expected {
+		t.Errorf("Wrong hedge policy. Got: %+v, expected: %+v.", got, expected)
+	}
+}
+
 func createHandler() cliware.Handler {
 	return cliware.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
 		return &http.Response{
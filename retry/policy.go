@@ -0,0 +1,225 @@
+package retry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Duration is time.Duration that can be read from configuration files. It is
+// written as string accepted by time.ParseDuration (e.g. "1.5s" or "200ms").
+type Duration time.Duration
+
+// UnmarshalText is implementation of encoding.TextUnmarshaler interface, which
+// is used by JSON and YAML decoders.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText is implementation of encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Backoff types supported by BackoffPolicy.
+const (
+	BackoffConstant           = "constant"
+	BackoffLinear             = "linear"
+	BackoffLinearJitter       = "linear_jitter"
+	BackoffExponential        = "exponential"
+	BackoffExponentialJitter  = "exponential_jitter"
+	BackoffFullJitter         = "full_jitter"
+	BackoffEqualJitter        = "equal_jitter"
+	BackoffDecorrelatedJitter = "decorrelated_jitter"
+)
+
+// BackoffPolicy describes backoff strategy in configuration files.
+type BackoffPolicy struct {
+	// Type is one of Backoff* constants.
+	Type string `json:"type" yaml:"type"`
+	// Base is constant duration, step for linear backoffs or minimal
+	// duration for other backoffs.
+	Base Duration `json:"base" yaml:"base"`
+	// Max is maximal duration of backoff (not used by constant backoff).
+	Max Duration `json:"max" yaml:"max"`
+	// Factor is used by exponential backoffs, defaults to 2.
+	Factor float64 `json:"factor" yaml:"factor"`
+}
+
+// Strategy returns BackoffStrategy described by policy.
+func (b BackoffPolicy) Strategy() (BackoffStrategy, error) {
+	base, max := time.Duration(b.Base), time.Duration(b.Max)
+	factor := b.Factor
+	if factor == 0 {
+		factor = 2
+	}
+	switch b.Type {
+	case BackoffConstant:
+		return ConstantBackoff(base), nil
+	case BackoffLinear:
+		return LinearBackoff(base, max), nil
+	case BackoffLinearJitter:
+		return LinearJitterBackoff(base, max), nil
+	case BackoffExponential:
+		return ExponentialBackoff(base, max, factor), nil
+	case BackoffExponentialJitter:
+		return ExponentialJitterBackoff(base, max, factor), nil
+	case BackoffFullJitter:
+		return FullJitterBackoff(base, max, nil), nil
+	case BackoffEqualJitter:
+		return EqualJitterBackoff(base, max, nil), nil
+	case BackoffDecorrelatedJitter:
+		return DecorrelatedJitterBackoff(base, max, nil), nil
+	}
+	return nil, fmt.Errorf("retry: unknown backoff type %q", b.Type)
+}
+
+// Policy describes retry behaviour in single value that can be loaded from
+// JSON or YAML configuration. Zero values mean that setting is not defined by
+// policy. Values set by other middlewares from this package take precedence
+// over policy and defaults are used for anything not defined by either.
+type Policy struct {
+	// MaxRetries is maximal number of retries, see Times.
+	MaxRetries int `json:"max_retries" yaml:"max_retries"`
+	// MaxDuration is maximal time spent retrying, see MaxDuration.
+	MaxDuration Duration `json:"max_duration" yaml:"max_duration"`
+	// PerAttemptTimeout is timeout of single attempt, see PerAttemptTimeout.
+	PerAttemptTimeout Duration `json:"per_attempt_timeout" yaml:"per_attempt_timeout"`
+	// RetryMethods are HTTP methods that can be retried, see Methods.
+	RetryMethods []string `json:"retry_methods" yaml:"retry_methods"`
+	// RetryOnError indicates that requests that failed with error should be
+	// retried.
+	RetryOnError bool `json:"retry_on_error" yaml:"retry_on_error"`
+	// RetryOnStatus is list of response status codes that should be retried.
+	RetryOnStatus []int `json:"retry_on_status" yaml:"retry_on_status"`
+	// Backoff is backoff strategy, see SetBackoffStrategy.
+	Backoff *BackoffPolicy `json:"backoff" yaml:"backoff"`
+	// RespectRetryAfter enables Retry-After header, capped at RetryAfterMax,
+	// see RespectRetryAfter.
+	RespectRetryAfter bool     `json:"respect_retry_after" yaml:"respect_retry_after"`
+	RetryAfterMax     Duration `json:"retry_after_max" yaml:"retry_after_max"`
+	// HedgeDelay and MaxHedges enable hedged requests, see Hedge.
+	HedgeDelay Duration `json:"hedge_delay" yaml:"hedge_delay"`
+	MaxHedges  int      `json:"max_hedges" yaml:"max_hedges"`
+
+	// backoff is strategy created from Backoff during validation
+	backoff BackoffStrategy
+}
+
+// Validate checks if policy is valid and prepares it for use.
+func (p *Policy) Validate() error {
+	if p.MaxRetries < 0 || p.MaxHedges < 0 {
+		return fmt.Errorf("retry: negative number of retries or hedges in policy")
+	}
+	p.backoff = nil
+	if p.Backoff != nil {
+		backoff, err := p.Backoff.Strategy()
+		if err != nil {
+			return err
+		}
+		p.backoff = backoff
+	}
+	return nil
+}
+
+// classifier returns classifier described by policy or nil if policy does not
+// define one.
+func (p *Policy) classifier() Classifier {
+	var classifiers []Classifier
+	if p.RetryOnError {
+		classifiers = append(classifiers, AnyErrorClassifier)
+	}
+	if len(p.RetryOnStatus) > 0 {
+		classifiers = append(classifiers, OnStatusClassifier(p.RetryOnStatus...))
+	}
+	if len(classifiers) == 0 {
+		return nil
+	}
+	return OrClassifier(classifiers...)
+}
+
+// Route selects policy for requests that match it. Empty fields match any
+// request.
+type Route struct {
+	// Host is host of request, optionally with port. Leading "*." matches
+	// any subdomain (e.g. "*.example.com").
+	Host string `json:"host" yaml:"host"`
+	// PathPrefix is prefix of request path.
+	PathPrefix string `json:"path_prefix" yaml:"path_prefix"`
+	// Methods are HTTP methods of request.
+	Methods []string `json:"methods" yaml:"methods"`
+	// Policy is used for matched requests.
+	Policy Policy `json:"policy" yaml:"policy"`
+}
+
+// match checks if route matches provided request.
+func (route *Route) match(r *http.Request) bool {
+	if route.Host != "" && !matchHost(route.Host, r) {
+		return false
+	}
+	if route.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+		return false
+	}
+	if len(route.Methods) > 0 && !stringInSlice(r.Method, route.Methods) {
+		return false
+	}
+	return true
+}
+
+func matchHost(pattern string, r *http.Request) bool {
+	host := r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	// pattern without port matches any port
+	if !strings.Contains(pattern, ":") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// PolicyRouter selects retry policy for request based on its host, path and
+// method. Routes are checked in order and policy of first matching route is
+// used. If no route matches, Default is used (if set). PolicyRouter can be
+// loaded from JSON or YAML configuration and has to be validated before use.
+type PolicyRouter struct {
+	Routes  []Route `json:"routes" yaml:"routes"`
+	Default *Policy `json:"default" yaml:"default"`
+}
+
+// Validate checks if all policies in router are valid.
+func (pr *PolicyRouter) Validate() error {
+	for i := range pr.Routes {
+		if err := pr.Routes[i].Policy.Validate(); err != nil {
+			return err
+		}
+	}
+	if pr.Default != nil {
+		return pr.Default.Validate()
+	}
+	return nil
+}
+
+// Match returns policy for provided request or nil if no policy matches it.
+func (pr *PolicyRouter) Match(r *http.Request) *Policy {
+	for i := range pr.Routes {
+		if pr.Routes[i].match(r) {
+			return &pr.Routes[i].Policy
+		}
+	}
+	return pr.Default
+}
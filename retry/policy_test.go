@@ -0,0 +1,168 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+const routerJSON = `{
+	"routes": [
+		{
+			"host": "api.example.com",
+			"path_prefix": "/v1/upload",
+			"methods": ["POST"],
+			"policy": {"max_retries": 1, "retry_methods": ["POST"], "retry_on_status": [503]}
+		},
+		{
+			"host": "*.example.com",
+			"policy": {
+				"max_retries": 3,
+				"max_duration": "1m",
+				"per_attempt_timeout": "2s",
+				"retry_on_error": true,
+				"retry_on_status": [429, 503],
+				"backoff": {"type": "constant", "base": "0s"},
+				"respect_retry_after": true,
+				"retry_after_max": "10s"
+			}
+		}
+	],
+	"default": {"max_retries": 5}
+}`
+
+func loadRouter(t *testing.T) *PolicyRouter {
+	router := &PolicyRouter{}
+	if err := json.Unmarshal([]byte(routerJSON), router); err != nil {
+		t.Fatal("Unable to load router:", err)
+	}
+	if err := router.Validate(); err != nil {
+		t.Fatal("Router not valid:", err)
+	}
+	return router
+}
+
+func TestPolicyRouter_Load(t *testing.T) {
+	router := loadRouter(t)
+	policy := router.Routes[1].Policy
+	if time.Duration(policy.MaxDuration) != time.Minute {
+		t.Errorf("Wrong max duration. Got: %s, expected: %s.", time.Duration(policy.MaxDuration), time.Minute)
+	}
+	if time.Duration(policy.PerAttemptTimeout) != 2*time.Second {
+		t.Errorf("Wrong per attempt timeout. Got: %s, expected: %s.", time.Duration(policy.PerAttemptTimeout), 2*time.Second)
+	}
+	if policy.backoff == nil {
+		t.Error("Backoff strategy not created during validation.")
+	}
+}
+
+func TestPolicyRouter_Match(t *testing.T) {
+	router := loadRouter(t)
+	for _, data := range []struct {
+		Method   string
+		URL      string
+		Expected *Policy
+	}{
+		{Method: "POST", URL: "https://api.example.com/v1/upload/file", Expected: &router.Routes[0].Policy},
+		{Method: "POST", URL: "https://API.example.com:8443/v1/upload", Expected: &router.Routes[0].Policy},
+		{Method: "GET", URL: "https://api.example.com/v1/upload/file", Expected: &router.Routes[1].Policy},
+		{Method: "GET", URL: "https://other.example.com/", Expected: &router.Routes[1].Policy},
+		{Method: "GET", URL: "https://example.org/", Expected: router.Default},
+	} {
+		req, _ := http.NewRequest(data.Method, data.URL, nil)
+		if got := router.Match(req); got != data.Expected {
+			t.Errorf("Wrong policy for %s %s. Got: %+v, expected: %+v.", data.Method, data.URL, got, data.Expected)
+		}
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, data := range []struct {
+		Policy Policy
+		Valid  bool
+	}{
+		{Policy: Policy{}, Valid: true},
+		{Policy: Policy{Backoff: &BackoffPolicy{Type: BackoffFullJitter}}, Valid: true},
+		{Policy: Policy{Backoff: &BackoffPolicy{Type: "unknown"}}, Valid: false},
+		{Policy: Policy{MaxRetries: -1}, Valid: false},
+	} {
+		err := data.Policy.Validate()
+		if (err == nil) != data.Valid {
+			t.Errorf("Wrong validation result for %+v: %v.", data.Policy, err)
+		}
+	}
+}
+
+func TestNewRetryTransportConfig_Policy(t *testing.T) {
+	router := loadRouter(t)
+	policy := &router.Routes[1].Policy
+
+	config := newRetryTransportConfig(setRetryTimes(context.Background(), 7), policy)
+	if config.MaxRetries != 7 {
+		t.Errorf("Middleware did not take precedence. Got: %d retries, expected: 7.", config.MaxRetries)
+	}
+	if config.MaxDuration != time.Minute {
+		t.Errorf("Wrong max duration. Got: %s, expected: %s.", config.MaxDuration, time.Minute)
+	}
+	if config.AttemptTimeout != 2*time.Second {
+		t.Errorf("Wrong per attempt timeout. Got: %s, expected: %s.", config.AttemptTimeout, 2*time.Second)
+	}
+	if !config.RetryAfter || config.RetryAfterMax != 10*time.Second {
+		t.Errorf("Wrong Retry-After config. Got: %t, %s.", config.RetryAfter, config.RetryAfterMax)
+	}
+	if !config.Classifier(&http.Response{StatusCode: 429}, nil) || config.Classifier(&http.Response{StatusCode: 500}, nil) {
+		t.Error("Wrong classifier created from policy.")
+	}
+
+	config = newRetryTransportConfig(context.Background(), policy)
+	if config.MaxRetries != 3 {
+		t.Errorf("Wrong max retries. Got: %d, expected: 3.", config.MaxRetries)
+	}
+
+	// policy set by middleware takes precedence over router
+	config = newRetryTransportConfig(setPolicy(context.Background(), router.Default), policy)
+	if config.MaxRetries != 5 {
+		t.Errorf("Wrong max retries. Got: %d, expected: 5.", config.MaxRetries)
+	}
+}
+
+func TestRetryTransport_RoundTripRouter(t *testing.T) {
+	mock := &mockRoundTripper{response: &http.Response{StatusCode: 503}}
+	transport, err := NewRetryTransportWithRouter(mock, loadRouter(t))
+	if err != nil {
+		t.Fatal("Unable to create transport:", err)
+	}
+	req, _ := http.NewRequest("POST", "https://api.example.com/v1/upload", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Error("retryTransport returned error:", err)
+	}
+	if mock.calledCount != 2 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 2.", mock.calledCount)
+	}
+
+	_, err = NewRetryTransportWithRouter(mock, &PolicyRouter{Default: &Policy{MaxRetries: -1}})
+	if err == nil {
+		t.Error("Expected error for invalid router.")
+	}
+}
+
+func TestUsePolicy(t *testing.T) {
+	policy := &Policy{MaxRetries: 3}
+	req := cliware.EmptyRequest()
+	resp, err := UsePolicy(policy).Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	if got := getPolicy(resp.Request.Context()); got != policy {
+		t.Errorf("Wrong policy. Got: %p, expected: %p.", got, policy)
+	}
+
+	_, err = UsePolicy(&Policy{MaxRetries: -1}).Exec(createHandler()).Handle(cliware.EmptyRequest())
+	if err == nil {
+		t.Error("Expected error for invalid policy.")
+	}
+}
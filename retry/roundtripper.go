@@ -2,7 +2,11 @@ package retry
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +17,7 @@ var (
 	defaultMaxDuration  = 3 * time.Minute
 	defaultBodyStrategy = CacheBodyStrategy
 	defaultRetryMethods = []string{"GET"}
+	defaultDrainLimit   = int64(4096)
 )
 
 // Enable modifiers provided client so that it can support all retry mechanisms
@@ -46,8 +51,22 @@ func NewRetryTransport(next http.RoundTripper) http.RoundTripper {
 	}
 }
 
+// NewRetryTransportWithRouter returns RoundTripper like NewRetryTransport,
+// but it also consults provided router to select retry policy for each
+// request. Router is validated before it is used.
+func NewRetryTransportWithRouter(next http.RoundTripper, router *PolicyRouter) (http.RoundTripper, error) {
+	if err := router.Validate(); err != nil {
+		return nil, err
+	}
+	return &retryTransport{
+		next:   next,
+		router: router,
+	}, nil
+}
+
 type retryTransport struct {
-	next http.RoundTripper
+	next   http.RoundTripper
+	router *PolicyRouter
 }
 
 type retryTransportConfig struct {
@@ -57,9 +76,21 @@ type retryTransportConfig struct {
 	MaxDuration  time.Duration
 	BodyStrategy BodyStrategy
 	RetryMethods []string
+	// RetryAfter indicates if Retry-After response header should be used
+	// instead of backoff strategy.
+	RetryAfter    bool
+	RetryAfterMax time.Duration
+	DrainLimit    int64
+	DiscardHook   func(*http.Response)
+	// AttemptTimeout is timeout for single attempt, zero means no timeout.
+	AttemptTimeout time.Duration
+	OnRetry        OnRetryFunc
+	Stats          *Stats
+	Budget         *Budget
+	Hedge          hedgePolicy
 }
 
-func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
+func newRetryTransportConfig(ctx context.Context, policy *Policy) *retryTransportConfig {
 	config := &retryTransportConfig{
 		Classifier:   getClassifier(ctx),
 		Backoff:      getBackoff(ctx),
@@ -67,6 +98,20 @@ func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
 		MaxDuration:  getMaxDuration(ctx),
 		BodyStrategy: getBodyStrategy(ctx),
 		RetryMethods: getRetryMethods(ctx),
+		DrainLimit:   getDrainLimit(ctx),
+		DiscardHook:  getDiscardHook(ctx),
+	}
+	config.AttemptTimeout = getPerAttemptTimeout(ctx)
+	config.OnRetry = getOnRetry(ctx)
+	config.Stats = getStats(ctx)
+	config.Budget = getBudget(ctx)
+	config.Hedge = getHedge(ctx)
+	config.RetryAfterMax, config.RetryAfter = getRetryAfterMax(ctx)
+	if p := getPolicy(ctx); p != nil {
+		policy = p
+	}
+	if policy != nil {
+		config.applyPolicy(ctx, policy)
 	}
 	if config.Classifier == nil {
 		config.Classifier = defaultClassifier
@@ -86,33 +131,95 @@ func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
 	if config.RetryMethods == nil || len(config.RetryMethods) == 0 {
 		config.RetryMethods = defaultRetryMethods
 	}
+	if config.DrainLimit < 0 {
+		config.DrainLimit = defaultDrainLimit
+	}
 	return config
 }
 
+// applyPolicy sets values from provided policy that were not set in provided
+// context by other middlewares.
+func (config *retryTransportConfig) applyPolicy(ctx context.Context, policy *Policy) {
+	if config.Classifier == nil {
+		config.Classifier = policy.classifier()
+	}
+	if config.Backoff == nil {
+		config.Backoff = policy.backoff
+	}
+	if ctx.Value(retryTimesKey) == nil && policy.MaxRetries > 0 {
+		config.MaxRetries = policy.MaxRetries
+	}
+	if config.MaxDuration == 0 {
+		config.MaxDuration = time.Duration(policy.MaxDuration)
+	}
+	if config.AttemptTimeout == 0 {
+		config.AttemptTimeout = time.Duration(policy.PerAttemptTimeout)
+	}
+	if len(config.RetryMethods) == 0 {
+		config.RetryMethods = policy.RetryMethods
+	}
+	if !config.RetryAfter && policy.RespectRetryAfter {
+		config.RetryAfter = true
+		config.RetryAfterMax = time.Duration(policy.RetryAfterMax)
+	}
+	if config.Hedge.MaxHedges == 0 && policy.MaxHedges > 0 {
+		config.Hedge = hedgePolicy{Delay: time.Duration(policy.HedgeDelay), MaxHedges: policy.MaxHedges}
+	}
+}
+
 func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	count := 0
 
-	config := newRetryTransportConfig(r.Context())
+	var policy *Policy
+	if t.router != nil {
+		policy = t.router.Match(r)
+	}
+	config := newRetryTransportConfig(r.Context(), policy)
 
-	getBody, err := config.BodyStrategy(r)
+	// resources held by body strategy are released once retry cycle is over
+	done := &cleanups{}
+	defer done.run()
+	getBody, err := config.BodyStrategy(r.WithContext(setCleanups(r.Context(), done)))
 	if err != nil {
 		return nil, err
 	}
 
+	if config.Budget != nil {
+		config.Budget.deposit()
+	}
+
 	start := time.Now().UTC()
+	attempts := 0
+	if stats := config.Stats; stats != nil {
+		defer func() {
+			stats.Attempts = attempts
+			stats.Elapsed = time.Now().UTC().Sub(start)
+		}()
+	}
+	// requests with idempotency key are safe to send multiple times
+	retryable := stringInSlice(r.Method, config.RetryMethods) ||
+		r.Header.Get(IdempotencyKeyHeader) != ""
+	body := getBody()
 	for {
-		// Copy request and sets its body to appropriate value
-		reqCopy := &http.Request{}
-		*reqCopy = *r
-		reqCopy.Body = getBody()
+		var resp *http.Response
+		var timedOut bool
+		var err error
+		attemptReq := r.WithContext(setAttempt(r.Context(), attempts+1))
+		if retryable && config.Hedge.MaxHedges > 0 {
+			resp, timedOut, err = t.hedgedAttempt(attemptReq, body, getBody, config)
+		} else {
+			// request is already a copy, so just set its body to appropriate value
+			attemptReq.Body = body
 
-		// perform actual request
-		resp, err := t.next.RoundTrip(reqCopy)
+			// perform actual request
+			resp, timedOut, err = t.attempt(attemptReq, config.AttemptTimeout)
+		}
+		attempts++
 
 		// check if we reached any of conditions for stopping retry cycle
-		classifier := !config.Classifier(resp, err)
+		classifier := !timedOut && !config.Classifier(resp, err)
 		maxRetries := count >= config.MaxRetries
-		supportedMethod := !stringInSlice(r.Method, config.RetryMethods)
+		supportedMethod := !retryable
 
 		currentDuration := time.Now().UTC().Sub(start)
 		maxDuration := currentDuration.Nanoseconds() > config.MaxDuration.Nanoseconds()
@@ -121,10 +228,141 @@ func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 			return resp, err
 		}
 
+		// prepare body for next attempt and give up if it can not be replayed
+		body = getBody()
+		if _, ok := body.(notReplayableBody); ok {
+			if err != nil {
+				return nil, &NotReplayableError{Err: err}
+			}
+			return resp, nil
+		}
+
+		// give up early if retry budget shared with other requests is spent
+		if config.Budget != nil && !config.Budget.withdraw() {
+			body.Close()
+			return resp, err
+		}
+
 		// if all else failed, increase number of retries and wait for some time
 		count++
-		time.Sleep(config.Backoff(count))
+		wait := config.wait(count, resp)
+		if config.OnRetry != nil {
+			config.OnRetry(count, resp, err, wait)
+		}
+		config.discard(resp)
+		if err := sleep(r.Context(), wait); err != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+}
+
+// discard releases resources held by response that will not be returned to
+// caller. Discard hook is called first, after that body is drained up to
+// configured limit and closed, so that connection can be reused.
+func (config *retryTransportConfig) discard(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	if config.DiscardHook != nil {
+		config.DiscardHook(resp)
+	}
+	if resp.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, config.DrainLimit))
+	resp.Body.Close()
+}
+
+// attempt sends provided request using underlying RoundTripper. If timeout is
+// set, request is sent with child context that expires after timeout and
+// boolean return value indicates if attempt failed because of it.
+func (t *retryTransport) attempt(r *http.Request, timeout time.Duration) (*http.Response, bool, error) {
+	if timeout <= 0 {
+		resp, err := t.next.RoundTrip(r)
+		return resp, false, err
+	}
+	parent := r.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	resp, err := t.next.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		timedOut := parent.Err() == nil && ctx.Err() == context.DeadlineExceeded
+		cancel()
+		return resp, timedOut, err
+	}
+	// context has to live until response body is consumed
+	if resp.Body != nil {
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	} else {
+		cancel()
+	}
+	return resp, false, err
+}
+
+// cancelBody is response body that cancels attempt context once it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait returns duration to wait before sending attempt with provided number.
+// If configured so, duration requested by server in Retry-After header of
+// previous response is used instead of backoff strategy.
+func (config *retryTransportConfig) wait(attempt int, resp *http.Response) time.Duration {
+	if config.RetryAfter && resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if config.RetryAfterMax > 0 {
+				return minDuration(d, config.RetryAfterMax)
+			}
+			return d
+		}
+	}
+	return config.Backoff(attempt)
+}
+
+// sleep pauses current goroutine for provided duration or until provided
+// context is done, whichever happens first. Context error is returned if
+// context got done before duration elapsed.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// parseRetryAfter parses value of Retry-After header, which can be either
+// number of seconds or HTTP-date, and returns duration relative to provided
+// time. Boolean return value indicates if header value was valid.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Duration(0), false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return time.Duration(0), false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return time.Duration(0), false
+	}
+	d := date.Sub(now)
+	if d < 0 {
+		d = time.Duration(0)
 	}
+	return d, true
 }
 
 func stringInSlice(s string, in []string) bool {
@@ -8,6 +8,9 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
 
 	"github.com/delicb/cliware"
 )
@@ -23,6 +26,54 @@ func (rt *mockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	return rt.response, rt.err
 }
 
+// trackingBody is response body that records how much of it was read and
+// whether it was closed.
+type trackingBody struct {
+	io.Reader
+	read   int
+	closed bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// bodyRoundTripper returns new response with tracking body on each call.
+type bodyRoundTripper struct {
+	status int
+	body   string
+	bodies []*trackingBody
+}
+
+func (rt *bodyRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := &trackingBody{Reader: strings.NewReader(rt.body)}
+	rt.bodies = append(rt.bodies, body)
+	return &http.Response{StatusCode: rt.status, Header: http.Header{}, Body: body}, nil
+}
+
+// hangingRoundTripper blocks first hang calls until request context is done
+// and responds immediately to all other calls.
+type hangingRoundTripper struct {
+	hang        int
+	calledCount int
+}
+
+func (rt *hangingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.calledCount++
+	if rt.calledCount <= rt.hang {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+}
+
 func TestEnable(t *testing.T) {
 	for _, client := range []*http.Client{
 		http.DefaultClient,
@@ -53,15 +104,16 @@ func TestNewRetryTransport(t *testing.T) {
 func TestRetryTransport_RoundTrip(t *testing.T) {
 	for _, data := range []struct {
 		//Mock          *mockRoundTripper
-		ExpectedCalls int
-		Classifier    Classifier
-		Backoff       BackoffStrategy
-		MaxRetries    int
-		MaxDuration   time.Duration
-		HTTPMethods   []string
-		SendMethod    string
-		BodyStrategy  BodyStrategy
-		ExpectedError string
+		ExpectedCalls  int
+		Classifier     Classifier
+		Backoff        BackoffStrategy
+		MaxRetries     int
+		MaxDuration    time.Duration
+		HTTPMethods    []string
+		SendMethod     string
+		BodyStrategy   BodyStrategy
+		IdempotencyKey string
+		ExpectedError  string
 	}{
 		{
 			//Mock:          &mockRoundTripper{},
@@ -78,6 +130,14 @@ func TestRetryTransport_RoundTrip(t *testing.T) {
 			Classifier:    func(resp *http.Response, err error) bool { return true },
 			SendMethod:    "POST",
 		},
+		{
+			ExpectedCalls:  2,
+			Classifier:     func(resp *http.Response, err error) bool { return true },
+			Backoff:        func(n int) time.Duration { return 0 },
+			MaxRetries:     1,
+			SendMethod:     "POST",
+			IdempotencyKey: "my-key",
+		},
 		{
 			ExpectedCalls: 0,
 			BodyStrategy:  func(r *http.Request) (func() io.ReadCloser, error) { return nil, errors.New("my error") },
@@ -88,6 +148,9 @@ func TestRetryTransport_RoundTrip(t *testing.T) {
 		transport := NewRetryTransport(mock)
 		req := cliware.EmptyRequest()
 		req.Method = data.SendMethod
+		if data.IdempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, data.IdempotencyKey)
+		}
 		req = req.WithContext(context.WithValue(req.Context(), classifierKey, data.Classifier))
 		req = req.WithContext(context.WithValue(req.Context(), backoffKey, data.Backoff))
 		req = req.WithContext(context.WithValue(req.Context(), maxDurationKey, data.MaxDuration))
@@ -108,3 +171,228 @@ func TestRetryTransport_RoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestRetryTransport_RoundTripContextCancel(t *testing.T) {
+	mock := &mockRoundTripper{err: errors.New("my error")}
+	transport := NewRetryTransport(mock)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := cliware.EmptyRequest().WithContext(ctx)
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Minute)))
+
+	start := time.Now()
+	_, err := transport.RoundTrip(req)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Context cancellation not respected, retry took %s.", elapsed)
+	}
+	if mock.calledCount != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", mock.calledCount)
+	}
+}
+
+func TestRetryTransportConfig_Wait(t *testing.T) {
+	for _, data := range []struct {
+		RetryAfter   string
+		Respect      bool
+		Max          time.Duration
+		ExpectedWait time.Duration
+	}{
+		{RetryAfter: "0", Respect: true, ExpectedWait: 0},
+		{RetryAfter: "120", Respect: true, Max: 10 * time.Millisecond, ExpectedWait: 10 * time.Millisecond},
+		{RetryAfter: "", Respect: true, ExpectedWait: time.Millisecond},
+		{RetryAfter: "0", Respect: false, ExpectedWait: time.Millisecond},
+	} {
+		config := &retryTransportConfig{
+			Backoff:       ConstantBackoff(time.Millisecond),
+			RetryAfter:    data.Respect,
+			RetryAfterMax: data.Max,
+		}
+		resp := &http.Response{Header: http.Header{}}
+		if data.RetryAfter != "" {
+			resp.Header.Set("Retry-After", data.RetryAfter)
+		}
+		got := config.wait(1, resp)
+		if got != data.ExpectedWait {
+			t.Errorf("Wrong wait duration. Got: %s, expected: %s.", got, data.ExpectedWait)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for _, data := range []struct {
+		Value    string
+		Duration time.Duration
+		OK       bool
+	}{
+		{Value: "", OK: false},
+		{Value: "5", Duration: 5 * time.Second, OK: true},
+		{Value: " 10 ", Duration: 10 * time.Second, OK: true},
+		{Value: "-1", OK: false},
+		{Value: "not a date", OK: false},
+		{Value: "Wed, 01 Mar 2017 12:00:30 GMT", Duration: 30 * time.Second, OK: true},
+		{Value: "Wed, 01 Mar 2017 11:00:00 GMT", Duration: 0, OK: true},
+	} {
+		got, ok := parseRetryAfter(data.Value, now)
+		if ok != data.OK || got != data.Duration {
+			t.Errorf("Wrong Retry-After for %q. Got: (%s, %t), expected: (%s, %t).",
+				data.Value, got, ok, data.Duration, data.OK)
+		}
+	}
+}
+
+func TestRetryTransport_RoundTripDiscard(t *testing.T) {
+	for _, data := range []struct {
+		DrainLimit   int64
+		Body         string
+		ExpectedRead int
+	}{
+		{DrainLimit: -1, Body: "server error", ExpectedRead: len("server error")},
+		{DrainLimit: 3, Body: "server error", ExpectedRead: 3},
+		{DrainLimit: 0, Body: "server error", ExpectedRead: 0},
+	} {
+		mock := &bodyRoundTripper{status: 500, body: data.Body}
+		transport := NewRetryTransport(mock)
+		var discarded []string
+		req := cliware.EmptyRequest()
+		req = req.WithContext(setClassifier(req.Context(), On500PlusClassifier))
+		req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(0)))
+		req = req.WithContext(setRetryTimes(req.Context(), 2))
+		if data.DrainLimit >= 0 {
+			req = req.WithContext(setDrainLimit(req.Context(), data.DrainLimit))
+		}
+		req = req.WithContext(setDiscardHook(req.Context(), func(resp *http.Response) {
+			discarded = append(discarded, resp.Status)
+		}))
+
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal("retryTransport returned error:", err)
+		}
+		if len(mock.bodies) != 3 {
+			t.Fatalf("Wrong number of calls. Got: %d, expected: 3.", len(mock.bodies))
+		}
+		if len(discarded) != 2 {
+			t.Errorf("Wrong number of discarded responses. Got: %d, expected: 2.", len(discarded))
+		}
+		for _, b := range mock.bodies[:2] {
+			if !b.closed {
+				t.Error("Discarded response body not closed.")
+			}
+			if b.read != data.ExpectedRead {
+				t.Errorf("Wrong number of drained bytes. Got: %d, expected: %d.", b.read, data.ExpectedRead)
+			}
+		}
+		if mock.bodies[2].closed {
+			t.Error("Returned response body closed.")
+		}
+		if got, _ := ioutil.ReadAll(resp.Body); string(got) != data.Body {
+			t.Errorf("Wrong body of returned response. Got: %s, expected: %s.", got, data.Body)
+		}
+	}
+}
+
+func TestRetryTransport_RoundTripPerAttemptTimeout(t *testing.T) {
+	mock := &hangingRoundTripper{hang: 2}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setClassifier(req.Context(), func(resp *http.Response, err error) bool { return false }))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(0)))
+	req = req.WithContext(setRetryTimes(req.Context(), 5))
+	req = req.WithContext(setPerAttemptTimeout(req.Context(), 10*time.Millisecond))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("retryTransport returned error:", err)
+	}
+	if mock.calledCount != 3 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 3.", mock.calledCount)
+	}
+	if got, _ := ioutil.ReadAll(resp.Body); string(got) != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: ok.", got)
+	}
+	resp.Body.Close()
+}
+
+func TestRetryTransport_RoundTripPerAttemptTimeoutParent(t *testing.T) {
+	mock := &hangingRoundTripper{hang: 100}
+	transport := NewRetryTransport(mock)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := cliware.EmptyRequest().WithContext(ctx)
+	req = req.WithContext(setClassifier(req.Context(), func(resp *http.Response, err error) bool { return false }))
+	req = req.WithContext(setPerAttemptTimeout(req.Context(), time.Minute))
+
+	_, err := transport.RoundTrip(req)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+	if mock.calledCount != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", mock.calledCount)
+	}
+}
+
+func TestRetryTransport_RoundTripOnRetryAndStats(t *testing.T) {
+	mock := &bodyRoundTripper{status: 503, body: "unavailable"}
+	transport := NewRetryTransport(mock)
+	var attempts []int
+	var waits []time.Duration
+	stats := &Stats{}
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setClassifier(req.Context(), On500PlusClassifier))
+	req = req.WithContext(setBackoff(req.Context(), func(n int) time.Duration { return time.Duration(n) * time.Millisecond }))
+	req = req.WithContext(setRetryTimes(req.Context(), 3))
+	req = req.WithContext(setStats(req.Context(), stats))
+	req = req.WithContext(setOnRetry(req.Context(), func(attempt int, resp *http.Response, err error, wait time.Duration) {
+		if resp == nil || resp.StatusCode != 503 {
+			t.Error("OnRetry called without previous response.")
+		}
+		attempts = append(attempts, attempt)
+		waits = append(waits, wait)
+	}))
+
+	_, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("retryTransport returned error:", err)
+	}
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(attempts, expected) {
+		t.Errorf("Wrong OnRetry attempts. Got: %v, expected: %v.", attempts, expected)
+	}
+	if expected := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}; !reflect.DeepEqual(waits, expected) {
+		t.Errorf("Wrong OnRetry waits. Got: %v, expected: %v.", waits, expected)
+	}
+	if stats.Attempts != 4 {
+		t.Errorf("Wrong number of attempts in stats. Got: %d, expected: 4.", stats.Attempts)
+	}
+	if stats.Elapsed < 6*time.Millisecond {
+		t.Errorf("Wrong elapsed time in stats. Got: %s, expected at least: %s.", stats.Elapsed, 6*time.Millisecond)
+	}
+}
+
+// attemptRoundTripper records attempt number of each request it receives.
+type attemptRoundTripper struct {
+	attempts []int
+}
+
+func (rt *attemptRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.attempts = append(rt.attempts, Attempt(r.Context()))
+	return nil, errors.New("my error")
+}
+
+func TestRetryTransport_RoundTripAttempt(t *testing.T) {
+	mock := &attemptRoundTripper{}
+	transport := NewRetryTransport(mock)
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+	transport.RoundTrip(req)
+	if !reflect.DeepEqual(mock.attempts, []int{1, 2, 3}) {
+		t.Errorf("Wrong attempt numbers. Got: %v, expected: [1 2 3].", mock.attempts)
+	}
+	if attempt := Attempt(req.Context()); attempt != 0 {
+		t.Errorf("Wrong attempt of original request. Got: %d, expected: 0.", attempt)
+	}
+}
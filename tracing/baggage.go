@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Baggage holds user defined key-value pairs propagated via baggage header,
+// as defined by W3C Baggage.
+type Baggage map[string]string
+
+// String returns value of baggage header for baggage. Members are sorted by
+// key and values are percent-encoded.
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for key := range b {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	members := make([]string, len(keys))
+	for i, key := range keys {
+		members[i] = key + "=" + url.PathEscape(b[key])
+	}
+	return strings.Join(members, ",")
+}
+
+// ParseBaggage parses value of baggage header. Invalid members and member
+// properties are ignored.
+func ParseBaggage(value string) Baggage {
+	b := Baggage{}
+	for _, member := range strings.Split(value, ",") {
+		// properties are not supported, they are dropped
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		i := strings.IndexByte(member, '=')
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(member[:i])
+		v, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+		if key == "" || err != nil {
+			continue
+		}
+		b[key] = v
+	}
+	return b
+}
+
+// ContextWithBaggage returns new context that holds provided baggage.
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey, b)
+}
+
+// BaggageFromContext returns baggage from provided context or nil if there
+// is none.
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey).(Baggage)
+	return b
+}
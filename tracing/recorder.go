@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is span recorded by Recorder.
+type RecordedSpan struct {
+	Method      string
+	URL         string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Status      int
+	Err         error
+	// Ended indicates if span was ended.
+	Ended bool
+}
+
+// Recorder is Tracer that keeps all spans in memory. It is intended for
+// tests. It is safe for concurrent use.
+type Recorder struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewRecorder creates new empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{now: time.Now}
+}
+
+// Start is implementation of Tracer interface.
+func (r *Recorder) Start(req *http.Request, span, parent SpanContext) Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &RecordedSpan{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		SpanContext: span,
+		Parent:      parent,
+		Start:       r.now(),
+	}
+	r.spans = append(r.spans, s)
+	return &recorderSpan{recorder: r, span: s}
+}
+
+// Spans returns copies of all recorded spans in order they were started.
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+	}
+	return spans
+}
+
+// Reset removes all recorded spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// recorderSpan is span returned by Recorder.
+type recorderSpan struct {
+	recorder *Recorder
+	span     *RecordedSpan
+}
+
+func (s *recorderSpan) End(status int, err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.span.End = s.recorder.now()
+	s.span.Status = status
+	s.span.Err = err
+	s.span.Ended = true
+}
@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidTraceparent is returned when traceparent header can not be
+// parsed.
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// FlagSampled is trace flag that indicates that caller may have recorded
+// trace data.
+const FlagSampled = byte(0x01)
+
+// TraceID is identifier of trace.
+type TraceID [16]byte
+
+// String returns lowercase hex representation of trace ID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID is identifier of span.
+type SpanID [8]byte
+
+// String returns lowercase hex representation of span ID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext is part of span that is propagated to other services, as
+// defined by W3C Trace Context.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// TraceState is value of tracestate header, vendor specific data that is
+	// propagated unchanged.
+	TraceState string
+}
+
+// IsValid returns true if both trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// IsSampled returns true if sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent returns value of traceparent header for span context.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses value of traceparent header. Trace state of
+// returned span context is empty.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	// version-traceid-parentid-flags, future versions can append fields
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	parts := strings.SplitN(value[:55], "-", 4)
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	version, ok := decodeHex(parts[0], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, ok := decodeHex(parts[1], 16)
+	if !ok {
+		return sc, ErrInvalidTraceparent
+	}
+	spanID, ok := decodeHex(parts[2], 8)
+	if !ok {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, ok := decodeHex(parts[3], 1)
+	if !ok {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex string into provided number of bytes.
+func decodeHex(s string, n int) ([]byte, bool) {
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != n {
+		return nil, false
+	}
+	return b, true
+}
+
+// newTraceID returns random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID returns random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// tracingKey is private type used for storing tracing data in context.
+type tracingKey string
+
+var (
+	spanContextKey tracingKey = "span-context"
+	baggageKey     tracingKey = "baggage"
+)
+
+// ContextWithSpanContext returns new context that holds provided span
+// context. Middleware uses it as parent of spans it creates.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// SpanContextFromContext returns span context from provided context.
+// Boolean return value indicates if valid span context was found.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
@@ -0,0 +1,56 @@
+package tracing_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for _, data := range []struct {
+		Value string
+		Valid bool
+	}{
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Valid: true},
+		{Value: " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 ", Valid: true},
+		{Value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", Valid: true},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", Valid: false},
+		{Value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", Valid: false},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", Valid: false},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01", Valid: false},
+		{Value: "", Valid: false},
+	} {
+		sc, err := tracing.ParseTraceparent(data.Value)
+		if data.Valid && err != nil {
+			t.Errorf("Failed to parse %q: %s.", data.Value, err)
+		}
+		if !data.Valid && err != tracing.ErrInvalidTraceparent {
+			t.Errorf("Wrong error for %q. Got: %v, expected: %v.", data.Value, err, tracing.ErrInvalidTraceparent)
+		}
+		if data.Valid && sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Wrong trace ID for %q: %s.", data.Value, sc.TraceID)
+		}
+	}
+
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, _ := tracing.ParseTraceparent(value)
+	if sc.Traceparent() != value || !sc.IsSampled() {
+		t.Errorf("Wrong round trip. Got: %s (sampled: %t), expected: %s.", sc.Traceparent(), sc.IsSampled(), value)
+	}
+}
+
+func TestBaggage(t *testing.T) {
+	b := tracing.ParseBaggage("userId=alice, serverNode = DF%2028 ;prop=1,invalid,=empty,isProduction=false")
+	expected := tracing.Baggage{"userId": "alice", "serverNode": "DF 28", "isProduction": "false"}
+	if !reflect.DeepEqual(b, expected) {
+		t.Errorf("Wrong baggage. Got: %v, expected: %v.", b, expected)
+	}
+	value := "isProduction=false,serverNode=DF%2028,userId=alice"
+	if b.String() != value {
+		t.Errorf("Wrong baggage header. Got: %s, expected: %s.", b.String(), value)
+	}
+}
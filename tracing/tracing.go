@@ -0,0 +1,147 @@
+// Package tracing contains middleware that propagates distributed tracing
+// context using W3C Trace Context (traceparent and tracestate headers) and
+// W3C Baggage (baggage header).
+//
+// For each request middleware creates new client span. Its parent is span
+// context from request context (see ContextWithSpanContext) or, if there is
+// none, span context from traceparent header already set on request (e.g.
+// by headers.FromContext middleware forwarding headers of incoming request).
+// If parent does not exist, new trace is started. Span start and end are
+// reported to Tracer, which can be adapted to any tracing system. Recorder
+// is Tracer that keeps spans in memory.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	c "github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/headers"
+)
+
+// Names of headers used for propagation.
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+	BaggageHeader     = "Baggage"
+)
+
+// Tracer is notified about spans created by middleware.
+type Tracer interface {
+	// Start is called before request is sent with span context of span
+	// created for it and its parent, which is zero if span starts new trace.
+	// Returned span is ended once response is received or request fails.
+	Start(req *http.Request, span, parent SpanContext) Span
+}
+
+// Span is span started by Tracer.
+type Span interface {
+	// End is called with status code of response (zero if there is no
+	// response) and error returned for request.
+	End(status int, err error)
+}
+
+// Middleware returns middleware that propagates tracing context and reports
+// spans to provided tracer. If tracer is nil, only propagation is done.
+func Middleware(tracer Tracer) c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			headerParent, headerBaggage := Extract(req.Header)
+			parent, ok := SpanContextFromContext(ctx)
+			if !ok {
+				parent = headerParent
+			}
+			baggage := BaggageFromContext(ctx)
+			if baggage == nil {
+				baggage = headerBaggage
+			}
+
+			span := SpanContext{
+				TraceID:    parent.TraceID,
+				SpanID:     newSpanID(),
+				Flags:      parent.Flags,
+				TraceState: parent.TraceState,
+			}
+			if !parent.IsValid() {
+				parent = SpanContext{}
+				span.TraceID = newTraceID()
+				span.Flags = FlagSampled
+			}
+			Inject(req.Header, span, baggage)
+
+			ctx = ContextWithSpanContext(ctx, span)
+			if baggage != nil {
+				ctx = ContextWithBaggage(ctx, baggage)
+			}
+			req = req.WithContext(ctx)
+			if tracer == nil {
+				return next.Handle(req)
+			}
+
+			s := tracer.Start(req, span, parent)
+			resp, err := next.Handle(req)
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			s.End(status, err)
+			return resp, err
+		})
+	})
+}
+
+// Extract returns span context and baggage from provided headers. Returned
+// span context is zero if headers do not contain valid traceparent and
+// baggage is nil if there is no baggage header.
+func Extract(header http.Header) (SpanContext, Baggage) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err == nil {
+		sc.TraceState = strings.Join(header[TracestateHeader], ",")
+	}
+	var baggage Baggage
+	if values, ok := header[BaggageHeader]; ok {
+		baggage = ParseBaggage(strings.Join(values, ","))
+	}
+	return sc, baggage
+}
+
+// Inject sets propagation headers for provided span context and baggage to
+// provided headers. Tracestate and baggage headers are removed if there is
+// no trace state or baggage.
+func Inject(header http.Header, sc SpanContext, baggage Baggage) {
+	for _, h := range Headers(sc, baggage) {
+		header[h.Key] = h.Value
+	}
+	if sc.TraceState == "" {
+		header.Del(TracestateHeader)
+	}
+	if len(baggage) == 0 {
+		header.Del(BaggageHeader)
+	}
+}
+
+// Headers returns propagation headers for provided span context and baggage
+// in format used by headers package, so they can be stored in context with
+// headers.ToContextList and set on requests by headers.FromContext.
+func Headers(sc SpanContext, baggage Baggage) []headers.Header {
+	var hh []headers.Header
+	if sc.IsValid() {
+		hh = append(hh, headers.Header{Key: TraceparentHeader, Value: []string{sc.Traceparent()}})
+		if sc.TraceState != "" {
+			hh = append(hh, headers.Header{Key: TracestateHeader, Value: []string{sc.TraceState}})
+		}
+	}
+	if len(baggage) > 0 {
+		hh = append(hh, headers.Header{Key: BaggageHeader, Value: []string{baggage.String()}})
+	}
+	return hh
+}
+
+// HeadersFromContext returns propagation headers for span context and
+// baggage stored in provided context. See Headers.
+func HeadersFromContext(ctx context.Context) []headers.Header {
+	sc, _ := SpanContextFromContext(ctx)
+	return Headers(sc, BaggageFromContext(ctx))
+}
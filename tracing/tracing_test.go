@@ -0,0 +1,116 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/headers"
+	"github.com/delicb/cliware-middlewares/tracing"
+)
+
+const parentTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+
+// createHandler returns handler that stores request it received and returns
+// provided response and error.
+func createHandler(sent **http.Request, resp *http.Response, err error) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		*sent = req
+		return resp, err
+	})
+}
+
+func TestMiddlewareNewTrace(t *testing.T) {
+	recorder := tracing.NewRecorder()
+	var sent *http.Request
+	req := cliware.EmptyRequest()
+	tracing.Middleware(recorder).Exec(createHandler(&sent, &http.Response{StatusCode: 201}, nil)).Handle(req)
+
+	sc, err := tracing.ParseTraceparent(sent.Header.Get("traceparent"))
+	if err != nil {
+		t.Fatal("Invalid traceparent header: ", err)
+	}
+	if !sc.IsSampled() {
+		t.Error("New trace is not sampled.")
+	}
+	if _, ok := sent.Header["Tracestate"]; ok {
+		t.Error("Tracestate header set without trace state.")
+	}
+	if _, ok := sent.Header["Baggage"]; ok {
+		t.Error("Baggage header set without baggage.")
+	}
+	if ctxSC, _ := tracing.SpanContextFromContext(sent.Context()); ctxSC.SpanID != sc.SpanID {
+		t.Error("Span context not set on request context.")
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("Wrong number of spans. Got: %d, expected: 1.", len(spans))
+	}
+	span := spans[0]
+	if span.SpanContext.SpanID != sc.SpanID || span.Parent.IsValid() {
+		t.Errorf("Wrong span: %+v.", span)
+	}
+	if !span.Ended || span.Status != 201 || span.Err != nil || span.Method != "GET" {
+		t.Errorf("Wrong span end: %+v.", span)
+	}
+}
+
+func TestMiddlewareParentFromContext(t *testing.T) {
+	recorder := tracing.NewRecorder()
+	parent, _ := tracing.ParseTraceparent(parentTraceparent)
+	parent.TraceState = "vendor=value"
+	ctx := tracing.ContextWithSpanContext(context.Background(), parent)
+	ctx = tracing.ContextWithBaggage(ctx, tracing.Baggage{"user": "alice"})
+
+	var sent *http.Request
+	myErr := errors.New("my error")
+	req := cliware.EmptyRequest().WithContext(ctx)
+	tracing.Middleware(recorder).Exec(createHandler(&sent, nil, myErr)).Handle(req)
+
+	sc, _ := tracing.ParseTraceparent(sent.Header.Get("traceparent"))
+	if sc.TraceID != parent.TraceID || sc.SpanID == parent.SpanID || sc.IsSampled() {
+		t.Errorf("Wrong child span context: %s.", sent.Header.Get("traceparent"))
+	}
+	if got := sent.Header.Get("tracestate"); got != "vendor=value" {
+		t.Errorf("Wrong tracestate. Got: %s, expected: vendor=value.", got)
+	}
+	if got := sent.Header.Get("baggage"); got != "user=alice" {
+		t.Errorf("Wrong baggage. Got: %s, expected: user=alice.", got)
+	}
+	span := recorder.Spans()[0]
+	if span.Parent.SpanID != parent.SpanID || span.Err != myErr || span.Status != 0 {
+		t.Errorf("Wrong span: %+v.", span)
+	}
+}
+
+func TestMiddlewareWithHeadersFromContext(t *testing.T) {
+	// headers of incoming request are forwarded using headers package
+	incoming := http.Header{}
+	incoming.Set("traceparent", parentTraceparent)
+	incoming.Set("tracestate", "vendor=value")
+	incoming.Set("baggage", "user=alice")
+	parent, baggage := tracing.Extract(incoming)
+	ctx := headers.ToContextList(context.Background(), "trace", tracing.Headers(parent, baggage))
+
+	var sent *http.Request
+	chain := cliware.NewChain(headers.FromContext("trace"), tracing.Middleware(nil))
+	req := cliware.EmptyRequest().WithContext(ctx)
+	chain.Exec(createHandler(&sent, nil, nil)).Handle(req)
+
+	sc, _ := tracing.ParseTraceparent(sent.Header.Get("traceparent"))
+	if sc.TraceID != parent.TraceID || sc.SpanID == parent.SpanID {
+		t.Errorf("Trace not continued: %s.", sent.Header.Get("traceparent"))
+	}
+	if sent.Header.Get("tracestate") != "vendor=value" || sent.Header.Get("baggage") != "user=alice" {
+		t.Errorf("Trace state or baggage not propagated: %v.", sent.Header)
+	}
+
+	// and span context set by middleware can be forwarded further the same way
+	hh := tracing.HeadersFromContext(sent.Context())
+	if len(hh) != 3 || hh[0].Value[0] != sent.Header.Get("traceparent") {
+		t.Errorf("Wrong headers from context: %v.", hh)
+	}
+}
@@ -2,6 +2,7 @@
 package url
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -61,20 +62,47 @@ func PathPrefix(path string) c.Middleware {
 }
 
 // Param replaces one or multiple URL parameters with given value.
+// Path as it was before replacement is available via Template.
 func Param(key, value string) c.Middleware {
-	return c.RequestProcessor(func(req *http.Request) error {
+	return paramProcessor(func(req *http.Request) {
 		req.URL.Path = replace(req.URL.Path, key, value)
-		return nil
 	})
 }
 
 // Params replaces all provided parameters in URL with mapped values.
+// Path as it was before replacement is available via Template.
 func Params(params map[string]string) c.Middleware {
-	return c.RequestProcessor(func(req *http.Request) error {
+	return paramProcessor(func(req *http.Request) {
 		for k, v := range params {
 			req.URL.Path = replace(req.URL.Path, k, v)
 		}
-		return nil
+	})
+}
+
+// templateKey is private type used for storing path template in context.
+type templateKey struct{}
+
+// Template returns path template of request with provided context, which is
+// path as it was before first Param or Params middleware replaced parameters
+// in it (e.g. "/users/:id"). Empty string is returned if parameters were not
+// replaced.
+func Template(ctx context.Context) string {
+	template, _ := ctx.Value(templateKey{}).(string)
+	return template
+}
+
+// paramProcessor returns middleware that stores path template to request
+// context, if it is not already stored, and replaces parameters in path using
+// provided function.
+func paramProcessor(replaceParams func(req *http.Request)) c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			if Template(req.Context()) == "" {
+				req = req.WithContext(context.WithValue(req.Context(), templateKey{}, req.URL.Path))
+			}
+			replaceParams(req)
+			return next.Handle(req)
+		})
 	})
 }
 
@@ -185,3 +185,27 @@ func TestParams(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplate(t *testing.T) {
+	var template string
+	handler := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		template = url.Template(req.Context())
+		return nil, nil
+	})
+	chain := cliware.NewChain(
+		url.Path("/users/:id/posts/:post"),
+		url.Param("id", "1"),
+		url.Params(map[string]string{"post": "2"}),
+	)
+	req := cliware.EmptyRequest()
+	chain.Exec(handler).Handle(req)
+	if template != "/users/:id/posts/:post" {
+		t.Errorf("Wrong template. Got: %s, expected: /users/:id/posts/:post.", template)
+	}
+	if req.URL.Path != "/users/1/posts/2" {
+		t.Errorf("Wrong path. Got: %s, expected: /users/1/posts/2.", req.URL.Path)
+	}
+	if url.Template(req.Context()) != "" {
+		t.Error("Template set on context of original request.")
+	}
+}